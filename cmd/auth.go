@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"golang.org/x/term"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func printTokenRequired(ae meshctl.AuthError) {
+	if ae.EmailSent {
+		pterm.Info.Println("Login token email sent.")
+	}
+	if ae.Email2FA && ae.SMS2FA {
+		pterm.Warning.Println("2FA required. Enter a token or type 'email'/'sms' to request one.")
+	} else if ae.SMS2FA {
+		pterm.Warning.Println("2FA required. Enter a token or type 'sms' to request one.")
+	} else if ae.Email2FA {
+		pterm.Warning.Println("2FA required. Enter a token or type 'email' to request one.")
+	} else {
+		pterm.Warning.Println("2FA required.")
+	}
+}
+
+func openConsole() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.OpenFile("CONIN$", os.O_RDWR, 0)
+	}
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// promptForToken asks for a 2FA token on the console and applies it to the
+// client. It returns false if no token was entered.
+func promptForToken(client *meshctl.Client, ae meshctl.AuthError) bool {
+	printTokenRequired(ae)
+
+	console, err := openConsole()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "2FA required but no console available (%v). Use --token flag.\n", err)
+		return false
+	}
+	defer console.Close()
+
+	for {
+		fmt.Fprint(console, "Enter 2FA token: ")
+		tokenBytes, err := term.ReadPassword(int(console.Fd()))
+		fmt.Fprintln(console)
+		if err != nil || len(tokenBytes) == 0 {
+			fmt.Fprintln(console, "No token entered, aborting.")
+			return false
+		}
+		token := strings.TrimSpace(string(tokenBytes))
+
+		switch strings.ToLower(token) {
+		case "email":
+			if !ae.Email2FA {
+				fmt.Fprintln(console, "Email token not available for this account.")
+				continue
+			}
+			client.SetToken("", true, false)
+			return true
+		case "sms":
+			if !ae.SMS2FA {
+				fmt.Fprintln(console, "SMS token not available for this account.")
+				continue
+			}
+			client.SetToken("", false, true)
+			return true
+		default:
+			client.SetToken(token, false, false)
+			return true
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// defaultCacheTTL is how long cached devices are used to resolve names
+// before the list is fetched again.
+const defaultCacheTTL = 5 * time.Minute
+
+// errNoDeviceCache is returned when a profile has no cached devices yet.
+var errNoDeviceCache = errors.New("no cached devices, run mcc ls first")
+
+// deviceCacheVersion is the version of the device cache format, 0 for
+// caches written before meshctl.Device had json tags.
+const deviceCacheVersion = 1
+
+// deviceCache is the last device list of a profile, as stored on disk.
+type deviceCache struct {
+	Version int              `json:"version"`
+	Updated time.Time        `json:"updated"`
+	Devices []meshctl.Device `json:"devices"`
+}
+
+// legacyDevice is meshctl.Device as stored by version 0 caches, with its
+// Go field names as keys.
+type legacyDevice struct {
+	Id           string
+	Name         string
+	DisplayName  string
+	OS           string
+	IP           string
+	Icon         int
+	Conn         int
+	Pwr          int
+	MeshID       string
+	MeshName     string
+	Domain       string
+	Description  string
+	Tags         []string
+	AgentVersion int
+	AgentType    int
+	LastConnect  time.Time
+	Consent      int
+}
+
+// cacheTTL returns how long cached devices may be used, 0 with --refresh.
+func cacheTTL(cmd *cobra.Command) time.Duration {
+	if refresh, _ := cmd.Flags().GetBool("refresh"); refresh {
+		return 0
+	}
+	ttl, err := cmd.Flags().GetDuration("cache-ttl")
+	if err != nil {
+		return defaultCacheTTL
+	}
+	return ttl
+}
+
+// readDeviceCache returns the cached devices of the active profile, however
+// old they are.
+func readDeviceCache() (*deviceCache, error) {
+	path, err := config.DeviceCachePath(config.GetDefaultProfileName())
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoDeviceCache
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cache deviceCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("invalid device cache %s: %w", path, err)
+	}
+	if cache.Version == 0 {
+		var legacy struct{ Devices []legacyDevice }
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("invalid device cache %s: %w", path, err)
+		}
+		cache.Devices = make([]meshctl.Device, len(legacy.Devices))
+		for i, d := range legacy.Devices {
+			cache.Devices[i] = meshctl.Device(d)
+		}
+	}
+	return &cache, nil
+}
+
+// writeDeviceCache stores devices as the cached devices of the active
+// profile.
+func writeDeviceCache(devices []meshctl.Device) error {
+	path, err := config.DeviceCachePath(config.GetDefaultProfileName())
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(deviceCache{Version: deviceCacheVersion, Updated: time.Now(), Devices: devices})
+	if err != nil {
+		return err
+	}
+
+	// Concurrent commands replace the file rather than write into it
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fetchDevices gets the devices from the server and caches them.
+func fetchDevices(ctx context.Context, client *meshctl.Client) ([]meshctl.Device, error) {
+	devices, err := client.Devices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The cache only saves lookups, a command works without it
+	writeDeviceCache(devices)
+	return devices, nil
+}
+
+// completeNodes completes -i and the target of mcc ssh with the aliases of
+// the active profile and the names of its cached devices. It never logs in.
+func completeNodes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// Completion runs without the root command's PersistentPreRun
+	if c, _ := cmd.Flags().GetString("config"); c != "" {
+		viper.SetConfigFile(c)
+	} else {
+		viper.SetConfigFile(config.DefaultConfigPath)
+	}
+	if config.LoadConfig() != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if p, _ := cmd.Flags().GetString("profile"); p != "" {
+		config.SetDefaultProfile(p, false)
+	}
+
+	var candidates []string
+	add := func(name string, description string) {
+		// Shells split completions with spaces into several words
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return
+		}
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(toComplete)) {
+			candidates = append(candidates, name+"\t"+description)
+		}
+	}
+
+	if p, err := config.GetDefaultProfile(); err == nil {
+		for _, name := range p.AliasNames() {
+			node, _ := p.Alias(name)
+			add(name, "alias of "+node)
+		}
+	}
+	if cache, err := readDeviceCache(); err == nil {
+		for _, d := range cache.Devices {
+			var details []string
+			for _, detail := range []string{d.DisplayName, d.IP, groupName(d)} {
+				if detail != "" {
+					details = append(details, detail)
+				}
+			}
+			description := strings.Join(details, ", ")
+			add(d.Name, description)
+			if !strings.EqualFold(d.DisplayName, d.Name) {
+				add(d.DisplayName, description)
+			}
+		}
+	}
+	return candidates, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSSHTarget completes the [user@]target argument of mcc ssh with
+// completeNodes, when -i does not name the node.
+func completeSSHTarget(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if nodeID, _ := cmd.Flags().GetString("nodeid"); len(args) > 0 || nodeID != "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	user, target, ok := strings.Cut(toComplete, "@")
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+	}
+	nodes, directive := completeNodes(cmd, args, target)
+	for i := range nodes {
+		nodes[i] = user + "@" + nodes[i]
+	}
+	return nodes, directive
+}
+
+// addNodeCompletion completes the -i flag of cmd with completeNodes.
+func addNodeCompletion(cmd *cobra.Command) {
+	cmd.RegisterFlagCompletionFunc("nodeid", completeNodes)
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+const testConfig = `{
+  "default_profile": "home",
+  "profiles": [
+    {"name": "home", "server": "mesh.example.com", "username": "admin", "aliases": {"db": "db01"}},
+    {"name": "work", "server": "mesh.example.org", "username": "admin"}
+  ]
+}`
+
+// useTestConfig loads testConfig and keeps device caches in a temporary
+// directory until the test ends. It returns the path of the config file.
+func useTestConfig(t *testing.T) string {
+	t.Helper()
+	keyring.MockInit()
+	cacheHome := xdg.CacheHome
+	xdg.CacheHome = t.TempDir()
+	t.Cleanup(func() {
+		xdg.CacheHome = cacheHome
+		viper.Reset()
+	})
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal("LoadConfig:", err)
+	}
+	return path
+}
+
+// writeTestCache stores devices as the cache of the active profile, as
+// written at updated.
+func writeTestCache(t *testing.T, updated time.Time, devices []meshctl.Device) {
+	t.Helper()
+	path, err := config.DeviceCachePath(config.GetDefaultProfileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(deviceCache{Version: deviceCacheVersion, Updated: updated, Devices: devices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		args []string
+		want time.Duration
+	}{
+		{args: nil, want: defaultCacheTTL},
+		{args: []string{"--cache-ttl", "1h"}, want: time.Hour},
+		{args: []string{"--cache-ttl", "0"}, want: 0},
+		{args: []string{"--refresh"}, want: 0},
+		{args: []string{"--refresh", "--cache-ttl", "1h"}, want: 0},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().Duration("cache-ttl", defaultCacheTTL, "")
+		cmd.Flags().Bool("refresh", false, "")
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if got := cacheTTL(cmd); got != tt.want {
+			t.Errorf("cacheTTL(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceCachePerProfile(t *testing.T) {
+	useTestConfig(t)
+	devices := []meshctl.Device{{Id: "node//web", Name: "web01"}}
+	if err := writeDeviceCache(devices); err != nil {
+		t.Fatal("writeDeviceCache:", err)
+	}
+
+	cache, err := readDeviceCache()
+	if err != nil {
+		t.Fatal("readDeviceCache:", err)
+	}
+	if len(cache.Devices) != 1 || cache.Devices[0].Id != "node//web" || time.Since(cache.Updated) > time.Minute {
+		t.Errorf("readDeviceCache() = %+v, want the written devices", cache)
+	}
+
+	// Another profile has its own cache
+	config.SetDefaultProfile("work", false)
+	if _, err := readDeviceCache(); !errors.Is(err, errNoDeviceCache) {
+		t.Errorf("readDeviceCache() of another profile = %v, want errNoDeviceCache", err)
+	}
+}
+
+func TestResolveNodeCache(t *testing.T) {
+	cached := []meshctl.Device{
+		{Id: "node//cached", Name: "web01"},
+		{Id: "node//nas1", Name: "nas"},
+		{Id: "node//nas2", Name: "nas"},
+	}
+
+	tests := []struct {
+		name     string
+		age      time.Duration
+		cacheTTL time.Duration
+		node     string
+		want     string
+	}{
+		{name: "fresh", age: time.Minute, cacheTTL: 5 * time.Minute, node: "web01", want: "node//cached"},
+		{name: "expired", age: 10 * time.Minute, cacheTTL: 5 * time.Minute, node: "web01", want: testNode},
+		{name: "refresh", age: 0, cacheTTL: 0, node: "web01", want: testNode},
+		// A cached name matching several devices may have been renamed since
+		{name: "ambiguous", age: time.Minute, cacheTTL: 5 * time.Minute, node: "nas", want: ""},
+		{name: "not cached", age: time.Minute, cacheTTL: 5 * time.Minute, node: "Web", want: testNode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			_, client := connectTestClient(t)
+			writeTestCache(t, time.Now().Add(-tt.age), cached)
+
+			got, err := newNodeResolver(client, tt.cacheTTL).resolveNode(context.Background(), tt.node)
+			if tt.want == "" {
+				if !errors.Is(err, errUnknownDevice) {
+					t.Errorf("resolveNode(%q) = %q, %v, want errUnknownDevice from the server", tt.node, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveNode(%q) = %q, %v, want %q", tt.node, got, err, tt.want)
+			}
+
+			// Fetching the devices refreshes the cache
+			cache, err := readDeviceCache()
+			if err != nil {
+				t.Fatal("readDeviceCache:", err)
+			}
+			fetched := cache.Devices[0].Id == testNode
+			if fetched != (tt.want == testNode) {
+				t.Errorf("cache holds %+v after resolving %q", cache.Devices, tt.node)
+			}
+		})
+	}
+}
+
+func TestCompleteNodes(t *testing.T) {
+	path := useTestConfig(t)
+	writeTestCache(t, time.Now().Add(-24*time.Hour), []meshctl.Device{
+		{Id: "node//web", Name: "web01", DisplayName: "Web", IP: "10.0.0.5", MeshName: "Office"},
+		{Id: "node//db", Name: "db01", DisplayName: "db01"},
+		{Id: "node//nas", Name: "nas", DisplayName: "NAS Box"},
+	})
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", path, "")
+		cmd.Flags().String("profile", "", "")
+		cmd.Flags().String("nodeid", "", "")
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+
+	tests := []struct {
+		complete func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+		cmd      *cobra.Command
+		args     []string
+		prefix   string
+		want     []string
+	}{
+		// Old caches still complete, names with spaces are left out
+		{completeNodes, newCmd(), nil, "", []string{
+			"db\talias of db01",
+			"web01\tWeb, 10.0.0.5, Office",
+			"Web\tWeb, 10.0.0.5, Office",
+			"db01\tdb01",
+			"nas\tNAS Box",
+		}},
+		{completeNodes, newCmd(), nil, "W", []string{"web01\tWeb, 10.0.0.5, Office", "Web\tWeb, 10.0.0.5, Office"}},
+		{completeSSHTarget, newCmd(), nil, "root@d", []string{"root@db\talias of db01", "root@db01\tdb01"}},
+		{completeSSHTarget, newCmd(), nil, "root", nil},
+		{completeSSHTarget, newCmd("--nodeid", "web01"), nil, "root@d", nil},
+		{completeSSHTarget, newCmd(), []string{"root@web01"}, "", nil},
+		// Last, --profile stays in effect
+		{completeNodes, newCmd("--profile", "work"), nil, "", nil},
+	}
+	for _, tt := range tests {
+		got, directive := tt.complete(tt.cmd, tt.args, tt.prefix)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("completion of %q = %q, want %q", tt.prefix, got, tt.want)
+		}
+		if directive&cobra.ShellCompDirectiveNoFileComp == 0 {
+			t.Errorf("completion of %q completes files", tt.prefix)
+		}
+	}
+}
+
+func TestReadLegacyDeviceCache(t *testing.T) {
+	useTestConfig(t)
+	path, err := config.DeviceCachePath(config.GetDefaultProfileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written before meshctl.Device had json tags
+	legacy := `{"updated": "2026-01-02T03:04:05Z", "devices": [{"Id": "node//web", "Name": "web01", "DisplayName": "Web", "MeshID": "mesh//office", "LastConnect": "2026-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := readDeviceCache()
+	if err != nil {
+		t.Fatal("readDeviceCache:", err)
+	}
+	want := meshctl.Device{Id: "node//web", Name: "web01", DisplayName: "Web", MeshID: "mesh//office", LastConnect: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if len(cache.Devices) != 1 || !reflect.DeepEqual(cache.Devices[0], want) {
+		t.Errorf("readDeviceCache() devices = %+v, want %+v", cache.Devices, want)
+	}
+}
@@ -0,0 +1,425 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// The control socket of a running mcc route, mcc up or mcc daemon takes one
+// JSON request per connection and answers it with one JSON response. After
+// a successful dial or shell response, the connection carries the session.
+
+// controlTimeout bounds a control socket exchange
+const controlTimeout = 30 * time.Second
+
+// controlRequest is a request to the control socket. Action is "info",
+// "devices", "ls", "add", "rm", "dial" or "shell".
+type controlRequest struct {
+	Action string `json:"action"`
+
+	// add: a -L spec (or -U spec with UDP), going through Node unless the
+	// spec names its own node. Relative socket paths are taken from Dir.
+	Spec         string `json:"spec,omitempty"`
+	UDP          bool   `json:"udp,omitempty"`
+	Node         string `json:"node,omitempty"`
+	GatewayPorts bool   `json:"gateway_ports,omitempty"`
+	Dir          string `json:"dir,omitempty"`
+
+	// rm: the tunnel to close
+	ID string `json:"id,omitempty"`
+
+	// dial: the port to connect to through Node
+	Target string `json:"target,omitempty"`
+	Port   int    `json:"port,omitempty"`
+
+	// shell: the terminal to open on Node
+	Protocol int `json:"protocol,omitempty"`
+	Cols     int `json:"cols,omitempty"`
+	Rows     int `json:"rows,omitempty"`
+}
+
+// controlResponse answers a request with the affected tunnels, or an error.
+type controlResponse struct {
+	Error   string             `json:"error,omitempty"`
+	Daemon  bool               `json:"daemon,omitempty"`
+	Tunnels []forwardStatsJSON `json:"tunnels,omitempty"`
+	Devices []meshctl.Device   `json:"devices,omitempty"`
+}
+
+// controlServer runs the forwards of a session and lets other processes
+// list, add and remove them through the control socket.
+type controlServer struct {
+	ctx    context.Context
+	client *meshctl.Client
+
+	// daemon is set for mcc daemon, whose session other commands reuse
+	daemon bool
+	// cacheTTL bounds the age of cached devices used to resolve nodes
+	cacheTTL time.Duration
+
+	mu      sync.Mutex
+	lastID  int
+	tunnels map[string]*liveTunnel
+	wg      sync.WaitGroup
+}
+
+// liveTunnel is a forward started by the control server.
+type liveTunnel struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newControlServer(ctx context.Context, client *meshctl.Client) *controlServer {
+	return &controlServer{
+		ctx:     ctx,
+		client:  client,
+		tunnels: make(map[string]*liveTunnel),
+	}
+}
+
+// controlSocketPath returns the control socket of the active profile, or
+// the one given with --control.
+func controlSocketPath(cmd *cobra.Command) (string, error) {
+	if path, _ := cmd.Flags().GetString("control"); path != "" {
+		return path, nil
+	}
+	return config.ControlSocketPath(config.GetDefaultProfileName())
+}
+
+// add starts a forward and returns its ID once it accepts connections.
+func (s *controlServer) add(f meshctl.Forward) (string, error) {
+	id, ctx, done := s.register()
+	f.Name = id
+	ready := make(chan int, 1)
+	routeErr := make(chan error, 1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := s.client.Route(ctx, f, ready)
+		done()
+		routeErr <- err
+	}()
+
+	select {
+	case <-ready:
+		return id, nil
+	case err := <-routeErr:
+		return "", err
+	}
+}
+
+// register adds a tunnel under a new ID. It runs until the returned context
+// is cancelled, e.g. by remove, and must then call done.
+func (s *controlServer) register() (id string, ctx context.Context, done func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	id = strconv.Itoa(s.lastID)
+	ctx, cancel := context.WithCancel(s.ctx)
+	tunnel := &liveTunnel{cancel: cancel, done: make(chan struct{})}
+	s.tunnels[id] = tunnel
+
+	return id, ctx, func() {
+		s.mu.Lock()
+		delete(s.tunnels, id)
+		s.mu.Unlock()
+		cancel()
+		close(tunnel.done)
+	}
+}
+
+// remove stops a forward and waits until it closed.
+func (s *controlServer) remove(id string) error {
+	s.mu.Lock()
+	tunnel, ok := s.tunnels[id]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no tunnel %q", id)
+	}
+
+	tunnel.cancel()
+	<-tunnel.done
+	return nil
+}
+
+// wait returns once all forwards are stopped, which happens when the
+// server's context is cancelled.
+func (s *controlServer) wait() {
+	s.wg.Wait()
+}
+
+// tunnelStats returns the stats of the tunnel with the given ID, or of all
+// tunnels if id is empty.
+func (s *controlServer) tunnelStats(id string) []forwardStatsJSON {
+	var tunnels []forwardStatsJSON
+	for _, stats := range s.client.Stats() {
+		if id == "" || stats.Forward.Name == id {
+			tunnels = append(tunnels, toStatsJSON(stats))
+		}
+	}
+	return tunnels
+}
+
+// listen opens the control socket at path and serves requests on it until
+// the server's context is cancelled.
+func (s *controlServer) listen(path string) error {
+	listener, err := net.Listen("unix", path)
+	if err != nil && removeStaleControlSocket(path) {
+		listener, err = net.Listen("unix", path)
+	}
+	if err != nil {
+		return err
+	}
+	// Anyone who can use the socket can open tunnels on our session
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	context.AfterFunc(s.ctx, func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return nil
+}
+
+// removeStaleControlSocket removes the socket at path if no process is
+// listening on it any more. It returns true if the socket was removed.
+func removeStaleControlSocket(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return false
+	}
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	return os.Remove(path) == nil
+}
+
+// handle answers one request.
+func (s *controlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	var request controlRequest
+	var response controlResponse
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		response.Error = "invalid request: " + err.Error()
+	} else if request.Action == "dial" || request.Action == "shell" {
+		s.stream(conn, request)
+		return
+	} else if err := s.dispatch(request, &response); err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func (s *controlServer) dispatch(request controlRequest, response *controlResponse) error {
+	switch request.Action {
+	case "info":
+		response.Daemon = s.daemon
+		return nil
+	case "devices":
+		ctx, cancel := context.WithTimeout(s.ctx, controlTimeout)
+		defer cancel()
+		devices, err := fetchDevices(ctx, s.client)
+		response.Devices = devices
+		return err
+	case "ls":
+		if len(s.client.Stats()) > 0 {
+			ctx, cancel := context.WithTimeout(s.ctx, controlTimeout)
+			defer cancel()
+			// The stats are still worth listing without it
+			s.client.PingServer(ctx)
+		}
+		response.Tunnels = s.tunnelStats("")
+		return nil
+	case "add":
+		f, err := s.parseForward(request)
+		if err != nil {
+			return err
+		}
+		id, err := s.add(f)
+		if err != nil {
+			return err
+		}
+		response.Tunnels = s.tunnelStats(id)
+		return nil
+	case "rm":
+		return s.remove(request.ID)
+	}
+	return fmt.Errorf("unknown action %q", request.Action)
+}
+
+// stream answers a dial or shell request and then carries the session over
+// conn until either side ends it.
+func (s *controlServer) stream(conn net.Conn, request controlRequest) {
+	var response controlResponse
+	node, err := s.resolveNode(request.Node)
+	if err == nil && request.Action == "dial" && request.Port == 0 {
+		err = errors.New("no port given")
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if json.NewEncoder(conn).Encode(response) != nil || err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	if request.Action == "dial" {
+		// Listed and removable like the forwards
+		id, ctx, done := s.register()
+		defer done()
+		f := meshctl.Forward{Name: id, NodeID: node, Target: request.Target, RemotePort: request.Port}
+		if err := s.client.ProxyConn(ctx, f, conn); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "Dial failed:", err)
+		}
+		return
+	}
+
+	// The requesting process went away once its input ends
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	t := meshctl.Terminal{
+		Stdin:  cancelOnEOF{Reader: conn, cancel: cancel},
+		Stdout: conn,
+		Cols:   request.Cols,
+		Rows:   request.Rows,
+	}
+	if err := s.client.ShellOn(ctx, node, request.Protocol, t); err != nil && ctx.Err() == nil {
+		fmt.Fprintln(os.Stderr, "Shell failed:", err)
+	}
+}
+
+// cancelOnEOF calls cancel once reading from Reader fails.
+type cancelOnEOF struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (r cancelOnEOF) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil {
+		r.cancel()
+	}
+	return n, err
+}
+
+// resolveNode resolves a node ID or device name on the server's session.
+func (s *controlServer) resolveNode(node string) (string, error) {
+	if node == "" {
+		return "", errors.New("no node given")
+	}
+	resolver := newNodeResolver(s.client, s.cacheTTL)
+	return resolver.resolveNode(s.ctx, node)
+}
+
+// parseForward turns an add request into a forward, resolving its node on
+// the server's session.
+func (s *controlServer) parseForward(request controlRequest) (meshctl.Forward, error) {
+	f, err := parseForward(request.Spec)
+	if err != nil {
+		return f, fmt.Errorf("invalid spec %q: %w", request.Spec, err)
+	}
+	if request.UDP {
+		if f.LocalPath != "" {
+			return f, errors.New("UDP needs a local port")
+		}
+		f.UDP = true
+	}
+	if f.LocalPath != "" && !filepath.IsAbs(f.LocalPath) && request.Dir != "" {
+		f.LocalPath = filepath.Join(request.Dir, f.LocalPath)
+	}
+
+	node := f.NodeID
+	if node == "" {
+		node = request.Node
+	}
+	f.NodeID, err = s.resolveNode(node)
+	if err != nil {
+		return f, err
+	}
+
+	forwards := []meshctl.Forward{f}
+	allowGatewayPorts(forwards, request.GatewayPorts)
+	return forwards[0], nil
+}
+
+// callControl sends a request to the control socket at path.
+func callControl(path string, request controlRequest) (*controlResponse, error) {
+	conn, response, err := dialControl(path, request)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	return response, nil
+}
+
+// dialControl sends a request to the control socket at path and returns the
+// connection, which carries the session of a dial or shell request.
+func dialControl(path string, request controlRequest) (net.Conn, *controlResponse, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no running mcc route, mcc up or mcc daemon found at %s: %w", path, err)
+	}
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	// The response is one line, the session may follow right behind it
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	var response controlResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if response.Error != "" {
+		conn.Close()
+		return nil, nil, errors.New(response.Error)
+	}
+	conn.SetDeadline(time.Time{})
+	return &streamConn{Conn: conn, reader: reader}, &response, nil
+}
+
+// streamConn reads Conn through a reader that may hold buffered data.
+type streamConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshcentraltest"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+const testNode = "node//a$b@c/d"
+
+// connectTestClient returns a client logged in to a fake server with one
+// online node, both closed when the test ends.
+func connectTestClient(t *testing.T) (*meshcentraltest.Server, *meshctl.Client) {
+	t.Helper()
+	srv := meshcentraltest.NewServer("admin", "secret")
+	t.Cleanup(srv.Close)
+	srv.Nodes = []meshcentraltest.Node{{ID: testNode, Name: "Web", RName: "web01", IP: "10.0.0.5", Pwr: 1, Conn: 1}}
+
+	client := meshctl.NewClient(srv.Host(), "admin", "secret")
+	client.Insecure = true
+	client.Timeout = 5 * time.Second
+	t.Cleanup(client.Close)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+	return srv, client
+}
+
+// startControlServer serves the control socket of client, as mcc daemon if
+// daemon is set, until the test ends and returns its path.
+func startControlServer(t *testing.T, client *meshctl.Client, daemon bool) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	server := newControlServer(ctx, client)
+	server.daemon = daemon
+	t.Cleanup(func() {
+		cancel()
+		server.wait()
+	})
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	if err := server.listen(path); err != nil {
+		t.Fatal("listen:", err)
+	}
+	return path
+}
+
+// echo writes message to conn and checks that it comes back.
+func echo(t *testing.T, conn net.Conn, message string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != message {
+		t.Errorf("echo = %q, want %q", buf, message)
+	}
+}
+
+func TestControlServerTunnels(t *testing.T) {
+	_, client := connectTestClient(t)
+	path := startControlServer(t, client, false)
+
+	response, err := callControl(path, controlRequest{Action: "add", Spec: "0:22", Node: testNode})
+	if err != nil {
+		t.Fatal("add:", err)
+	}
+	if len(response.Tunnels) != 1 || response.Tunnels[0].ID != "1" || response.Tunnels[0].Remote != "node:22" {
+		t.Fatalf("add = %+v, want tunnel 1 to node:22", response.Tunnels)
+	}
+
+	conn, err := net.Dial("tcp", response.Tunnels[0].Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn, "hello")
+
+	// ls reports the traffic and pings the server
+	response, err = callControl(path, controlRequest{Action: "ls"})
+	if err != nil {
+		t.Fatal("ls:", err)
+	}
+	if len(response.Tunnels) != 1 {
+		t.Fatalf("ls returned %d tunnels, want 1", len(response.Tunnels))
+	}
+	if got := response.Tunnels[0]; got.Connections != 1 || got.BytesOut != 5 || got.ServerRTTMillis <= 0 {
+		t.Errorf("ls = %+v, want 1 connection, 5 bytes out and the server RTT", got)
+	}
+
+	if _, err := callControl(path, controlRequest{Action: "rm", ID: "1"}); err != nil {
+		t.Fatal("rm:", err)
+	}
+	response, err = callControl(path, controlRequest{Action: "ls"})
+	if err != nil {
+		t.Fatal("ls:", err)
+	}
+	if len(response.Tunnels) != 0 {
+		t.Errorf("ls after rm = %+v, want no tunnels", response.Tunnels)
+	}
+	if _, err := callControl(path, controlRequest{Action: "rm", ID: "1"}); err == nil {
+		t.Error("rm of a removed tunnel succeeded")
+	}
+}
+
+func TestControlServerDial(t *testing.T) {
+	_, client := connectTestClient(t)
+	path := startControlServer(t, client, false)
+
+	conn, _, err := dialControl(path, controlRequest{Action: "dial", Node: testNode, Port: 22})
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer conn.Close()
+	echo(t, conn, "SSH-2.0-test\r\n")
+
+	// The session is listed under its own ID and can be removed
+	response, err := callControl(path, controlRequest{Action: "ls"})
+	if err != nil {
+		t.Fatal("ls:", err)
+	}
+	if len(response.Tunnels) != 1 || response.Tunnels[0].ID == "" || response.Tunnels[0].Remote != "node:22" {
+		t.Fatalf("ls = %+v, want the dial session with an ID", response.Tunnels)
+	}
+	if _, err := callControl(path, controlRequest{Action: "rm", ID: response.Tunnels[0].ID}); err != nil {
+		t.Fatal("rm:", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() succeeded after rm, want the session closed")
+	}
+}
+
+func TestControlServerErrors(t *testing.T) {
+	_, client := connectTestClient(t)
+	path := startControlServer(t, client, false)
+
+	tests := []struct {
+		request controlRequest
+		want    string
+	}{
+		{controlRequest{Action: "reboot"}, "unknown action"},
+		{controlRequest{Action: "add", Spec: "0:22"}, "no node given"},
+		{controlRequest{Action: "add", Spec: "8080:", Node: testNode}, "invalid spec"},
+		{controlRequest{Action: "rm", ID: "7"}, "no tunnel"},
+		{controlRequest{Action: "dial", Node: testNode}, "no port given"},
+		{controlRequest{Action: "dial", Port: 22}, "no node given"},
+	}
+	for _, tt := range tests {
+		_, err := callControl(path, tt.request)
+		if err == nil {
+			t.Errorf("%+v succeeded, want an error", tt.request)
+		} else if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%+v = %v, want an error containing %q", tt.request, err, tt.want)
+		}
+	}
+}
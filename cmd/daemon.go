@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// daemonStartTimeout bounds how long mcc daemon --detach waits for the
+// background process to listen.
+const daemonStartTimeout = 30 * time.Second
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Hold one session for other mcc commands, like ssh ControlMaster",
+	Long: `Logs in once and keeps the session open, renewing its cookies and
+reconnecting when needed. While it runs, mcc route, mcc ssh and mcc shell of
+the same profile go through it instead of logging in again. Forwards added
+by mcc route keep running in the daemon after mcc route returns; list and
+remove them with mcc tunnels.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		detach, _ := cmd.Flags().GetBool("detach")
+
+		path, err := controlSocketPath(cmd)
+		pExit("Control socket unavailable:", err)
+		if _, err := callControl(path, controlRequest{Action: "info"}); err == nil {
+			pExit("Failed to start daemon:", fmt.Errorf("%s is already in use", path))
+		}
+
+		ctx := cmd.Context()
+		client := newForwardingClient(cmd)
+		client.UDPIdleTimeout, _ = cmd.Flags().GetDuration("udp-timeout")
+
+		if cookieStdin, _ := cmd.Flags().GetBool("cookie-stdin"); cookieStdin {
+			// Started by --detach, which already logged in and has no
+			// terminal to ask for a 2FA token on. Once the cookie expired, a
+			// login needing a token fails instead of prompting.
+			cookie, err := readDaemonCookie(os.Stdin)
+			pExit("Failed to read session cookie:", err)
+			signal.Ignore(syscall.SIGHUP)
+			client.AuthCookie = cookie
+			client.SetToken("", false, false)
+			client.TokenPrompt = nil
+		}
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
+
+		if detach {
+			pExit("Failed to start daemon:", startDaemon(path, client.SessionCookie()))
+			return
+		}
+
+		server := newControlServer(ctx, client)
+		server.daemon = true
+		server.cacheTTL = cacheTTL(cmd)
+		pExit("Failed to open control socket:", server.listen(path))
+		fmt.Printf("Daemon listening on %s. Press ctrl-c to exit.\n", path)
+
+		<-ctx.Done()
+		server.wait()
+	},
+}
+
+// startDaemon runs mcc daemon in the background, logged in with cookie and
+// detached from the terminal, and waits until it listens on path. The
+// cookie is written to its standard input, where unlike the command line
+// or environment other users cannot read it. Its output goes to a log file
+// next to the socket.
+func startDaemon(path string, cookie string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".log"
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	daemon := daemonCommand(executable, os.Args[1:], cookie)
+	daemon.Stdout = log
+	daemon.Stderr = log
+	detachProcess(daemon)
+	if err := daemon.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		daemon.Wait()
+		close(exited)
+	}()
+
+	deadline := time.After(daemonStartTimeout)
+	for {
+		if response, err := callControl(path, controlRequest{Action: "info"}); err == nil && response.Daemon {
+			fmt.Printf("Daemon started with pid %d, logging to %s.\n", daemon.Process.Pid, logPath)
+			return nil
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("daemon exited, see %s", logPath)
+		case <-deadline:
+			return fmt.Errorf("daemon did not start listening on %s, see %s", path, logPath)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// daemonCommand returns the command running mcc daemon with args in the
+// foreground, logged in with cookie. The cookie is passed on standard input
+// rather than in the arguments or environment, which other users may see.
+func daemonCommand(executable string, args []string, cookie string) *exec.Cmd {
+	daemon := exec.Command(executable, append(slices.Clone(args), "--detach=false", "--cookie-stdin")...)
+	daemon.Stdin = strings.NewReader(cookie + "\n")
+	return daemon
+}
+
+// readDaemonCookie reads the session cookie startDaemon writes to r.
+func readDaemonCookie(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	cookie := strings.TrimSpace(line)
+	if cookie == "" {
+		if err == nil || err == io.EOF {
+			err = errors.New("no session cookie on standard input")
+		}
+		return "", err
+	}
+	return cookie, nil
+}
+
+// daemonSocket returns the control socket of a running mcc daemon of the
+// active profile, or "" if there is none or --no-daemon is given.
+func daemonSocket(cmd *cobra.Command) string {
+	if noDaemon, _ := cmd.Flags().GetBool("no-daemon"); noDaemon {
+		return ""
+	}
+	path, err := controlSocketPath(cmd)
+	if err != nil {
+		return ""
+	}
+	response, err := callControl(path, controlRequest{Action: "info"})
+	if err != nil || !response.Daemon {
+		return ""
+	}
+	return path
+}
+
+// daemonSelectDevice is selectDevice for the devices known to the daemon
+// at path.
+func daemonSelectDevice(cmd *cobra.Command, path string) string {
+	response, err := callControl(path, controlRequest{Action: "devices"})
+	pExit("Failed to list devices:", err)
+	return pickDevice(cmd, response.Devices)
+}
+
+// daemonResolver returns a resolver over the devices known to the daemon
+// at path.
+func daemonResolver(path string) *nodeResolver {
+	response, err := callControl(path, controlRequest{Action: "devices"})
+	pExit("Failed to list devices:", err)
+	p, _ := config.GetDefaultProfile()
+	return &nodeResolver{profile: p, devices: response.Devices, loaded: true}
+}
+
+// addTunnels asks the control socket at path to start forwards and prints
+// them. It returns the IDs of the added tunnels.
+func addTunnels(path string, requests []controlRequest) []string {
+	dir, _ := os.Getwd()
+	var ids []string
+	for _, request := range requests {
+		request.Action = "add"
+		request.Dir = dir
+		response, err := callControl(path, request)
+		pExit("Request failed:", err)
+		for _, t := range response.Tunnels {
+			pterm.Success.Printf("Added tunnel %s: %s to %s\n", t.ID, t.Local, t.Remote)
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// proxyControl relays stdin and stdout through a dial request to the
+// control socket at path.
+func proxyControl(path string, request controlRequest, stdin io.Reader, stdout io.Writer) error {
+	conn, _, err := dialControl(path, request)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, stdin)
+		conn.Close()
+	}()
+	_, err = io.Copy(stdout, conn)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// listenControl listens on a random loopback port and relays every
+// connection through a dial request to the control socket at path, until
+// ctx is cancelled. It returns the port.
+func listenControl(ctx context.Context, path string, request controlRequest) (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", meshctl.ErrBindFailed, err)
+	}
+	context.AfterFunc(ctx, func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer local.Close()
+				remote, _, err := dialControl(path, request)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Dial failed:", err)
+					return
+				}
+				defer remote.Close()
+
+				go func() {
+					io.Copy(remote, local)
+					remote.Close()
+				}()
+				io.Copy(local, remote)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// shellControl opens a terminal on node through the control socket at path,
+// attached to stdin and stdout.
+func shellControl(path string, node string, protocol int, stdin io.Reader, stdout io.Writer) error {
+	request := controlRequest{Action: "shell", Node: node, Protocol: protocol}
+	if f, ok := stdout.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		request.Cols, request.Rows, _ = term.GetSize(int(f.Fd()))
+	}
+	conn, _, err := dialControl(path, request)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The daemon handles ctrl-] like a local session
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		oldState, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(f.Fd()), oldState)
+	}
+
+	go func() {
+		io.Copy(conn, stdin)
+	}()
+	_, err = io.Copy(stdout, conn)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().BoolP("detach", "d", false, "Run in the background once logged in")
+	daemonCmd.Flags().Duration("udp-timeout", meshctl.DefaultUDPIdleTimeout, "Close a UDP session after this long without traffic")
+	daemonCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
+	daemonCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
+	// Set by --detach for the background process
+	daemonCmd.Flags().Bool("cookie-stdin", false, "Log in with the session cookie read from standard input")
+	daemonCmd.Flags().MarkHidden("cookie-stdin")
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits until b contains want.
+func waitForOutput(t *testing.T, b *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(b.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output %q does not contain %q", b.String(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// controlCommand returns a command with the control socket flags set.
+func controlCommand(path string, noDaemon bool) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("control", path, "")
+	cmd.Flags().Bool("no-daemon", noDaemon, "")
+	return cmd
+}
+
+func TestReadDaemonCookie(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "cookie\n", want: "cookie"},
+		{input: "cookie", want: "cookie"},
+		{input: " cookie \r\nrest\n", want: "cookie"},
+		{input: "", wantErr: true},
+		{input: "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := readDaemonCookie(strings.NewReader(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("readDaemonCookie(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("readDaemonCookie(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDaemonCommand(t *testing.T) {
+	args := []string{"daemon", "--detach"}
+	daemon := daemonCommand("/usr/bin/mcc", args, "secret-cookie")
+
+	want := []string{"/usr/bin/mcc", "daemon", "--detach", "--detach=false", "--cookie-stdin"}
+	if !slices.Equal(daemon.Args, want) {
+		t.Errorf("Args = %q, want %q", daemon.Args, want)
+	}
+	if len(args) != 2 {
+		t.Errorf("args modified to %q", args)
+	}
+	for _, env := range daemon.Env {
+		if strings.Contains(env, "secret-cookie") {
+			t.Errorf("cookie passed in the environment: %s", env)
+		}
+	}
+
+	// The background process reads the cookie back from its input
+	cookie, err := readDaemonCookie(daemon.Stdin)
+	if err != nil || cookie != "secret-cookie" {
+		t.Errorf("readDaemonCookie(Stdin) = %q, %v, want secret-cookie", cookie, err)
+	}
+}
+
+func TestDaemonSocket(t *testing.T) {
+	_, client := connectTestClient(t)
+	daemon := startControlServer(t, client, true)
+	route := startControlServer(t, client, false)
+	missing := filepath.Join(t.TempDir(), "missing.sock")
+
+	tests := []struct {
+		path     string
+		noDaemon bool
+		want     string
+	}{
+		{path: daemon, want: daemon},
+		{path: daemon, noDaemon: true, want: ""},
+		// mcc route serves the socket too, but its session is not shared
+		{path: route, want: ""},
+		// Without a daemon, commands log in themselves
+		{path: missing, want: ""},
+	}
+	for _, tt := range tests {
+		if got := daemonSocket(controlCommand(tt.path, tt.noDaemon)); got != tt.want {
+			t.Errorf("daemonSocket(%s, no-daemon %v) = %q, want %q", tt.path, tt.noDaemon, got, tt.want)
+		}
+	}
+}
+
+func TestProxyControl(t *testing.T) {
+	_, client := connectTestClient(t)
+	path := startControlServer(t, client, true)
+
+	stdin, input := io.Pipe()
+	var stdout syncBuffer
+	proxyErr := make(chan error, 1)
+	go func() {
+		proxyErr <- proxyControl(path, controlRequest{Action: "dial", Node: testNode, Port: 22}, stdin, &stdout)
+	}()
+
+	input.Write([]byte("SSH-2.0-test\r\n"))
+	waitForOutput(t, &stdout, "SSH-2.0-test\r\n")
+
+	// The end of the input ends the proxy
+	input.Close()
+	select {
+	case err := <-proxyErr:
+		if err != nil {
+			t.Errorf("proxyControl() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxyControl did not return after its input ended")
+	}
+}
+
+func TestShellControl(t *testing.T) {
+	_, client := connectTestClient(t)
+	path := startControlServer(t, client, true)
+
+	stdin, input := io.Pipe()
+	defer input.Close()
+	var stdout syncBuffer
+	shellErr := make(chan error, 1)
+	go func() {
+		shellErr <- shellControl(path, testNode, 1, stdin, &stdout)
+	}()
+
+	input.Write([]byte("uptime\r"))
+	waitForOutput(t, &stdout, "uptime\r")
+
+	// ctrl-] ends the session in the daemon
+	input.Write([]byte{0x1d})
+	select {
+	case err := <-shellErr:
+		if err != nil {
+			t.Errorf("shellControl() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shellControl did not return after ctrl-]")
+	}
+}
@@ -0,0 +1,11 @@
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess keeps ctrl-c in the console from reaching cmd.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
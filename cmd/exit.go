@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/pterm/pterm"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// Exit codes, one per failure class so scripts can react to them
+const (
+	exitError          = 1 // any other failure
+	exitUsage          = 2 // invalid flags or arguments
+	exitBadCredentials = 3 // wrong username, password or arguments
+	exitTokenRequired  = 4 // 2FA token missing or wrong
+	exitBadTLSCert     = 5 // server certificate rejected
+	exitConnectFailed  = 6 // server unreachable or timed out
+	exitBindFailed     = 7 // local port unavailable
+	exitConfig         = 8 // profile or config problem
+)
+
+// usageError marks an error in the flags or arguments of a command.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var notFound *config.ProfileNotFoundError
+	var usage usageError
+	switch {
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, meshctl.ErrTokenRequired):
+		return exitTokenRequired
+	case errors.Is(err, meshctl.ErrBadTLSCert):
+		return exitBadTLSCert
+	case errors.Is(err, meshctl.ErrBadCredentials), errors.Is(err, meshctl.ErrBadArgs):
+		return exitBadCredentials
+	case errors.Is(err, meshctl.ErrConnectFailed), errors.Is(err, meshctl.ErrConnectionClosed),
+		errors.Is(err, context.DeadlineExceeded):
+		return exitConnectFailed
+	case errors.Is(err, meshctl.ErrBindFailed):
+		return exitBindFailed
+	case errors.As(err, &notFound), errors.Is(err, config.ErrKeyring),
+		errors.Is(err, config.ErrTunnelSetNotFound):
+		return exitConfig
+	}
+	return exitError
+}
+
+// interrupted returns nil if err only reports that the command was
+// cancelled, as on ctrl-c, which is not a failure.
+func interrupted(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// pExit prints s and err to stderr and exits with the code matching err,
+// if err is not nil.
+func pExit(s string, err error) {
+	if err != nil {
+		pterm.Error.WithWriter(os.Stderr).Println(s, err)
+		os.Exit(exitCode(err))
+	}
+}
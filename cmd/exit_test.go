@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: errors.New("boom"), want: exitError},
+		{err: usageError{errors.New("at least one -L or -U is required")}, want: exitUsage},
+		{err: meshctl.ErrTokenRequired, want: exitTokenRequired},
+		{err: meshctl.ErrBadTLSCert, want: exitBadTLSCert},
+		{err: meshctl.ErrBadCredentials, want: exitBadCredentials},
+		{err: meshctl.ErrBadArgs, want: exitBadCredentials},
+		{err: meshctl.ErrConnectFailed, want: exitConnectFailed},
+		{err: meshctl.ErrConnectionClosed, want: exitConnectFailed},
+		{err: context.DeadlineExceeded, want: exitConnectFailed},
+		{err: meshctl.ErrBindFailed, want: exitBindFailed},
+		{err: &config.ProfileNotFoundError{}, want: exitConfig},
+		{err: config.ErrKeyring, want: exitConfig},
+		{err: config.ErrTunnelSetNotFound, want: exitConfig},
+		// Wrapped errors keep their code
+		{err: fmt.Errorf("login: %w", meshctl.ErrTokenRequired), want: exitTokenRequired},
+		{err: fmt.Errorf("route: %w", fmt.Errorf("listen: %w", meshctl.ErrBindFailed)), want: exitBindFailed},
+		{err: fmt.Errorf("devices: %w", context.DeadlineExceeded), want: exitConnectFailed},
+		{err: fmt.Errorf("profile: %w", &config.ProfileNotFoundError{}), want: exitConfig},
+		{err: usageError{fmt.Errorf("spec: %w", meshctl.ErrBindFailed)}, want: exitUsage},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/lexpaval/mesh-central-client-go/internal/meshcentral"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
 	"github.com/spf13/cobra"
 
 	"github.com/pterm/pterm"
@@ -19,23 +19,25 @@ var listCmd = &cobra.Command{
 	Long:    ``,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		meshcentral.ApplySettings(
-			"",
-			0,
-			0,
-			"",
-			false,
-			false,
-		)
-
-		meshcentral.StartSocket()
+		if cached, _ := cmd.Flags().GetBool("cached"); cached {
+			cache, err := readDeviceCache()
+			pExit("Failed to read cached devices:", err)
+			if name := getOutputFormat(cmd).name; name == "table" || name == "wide" {
+				pterm.Info.Printf("Devices as of %s ago\n", time.Since(cache.Updated).Round(time.Second))
+			}
+			pExit("Failed to print devices:", printDevices(cmd, getSelector(cmd).apply(cache.Devices)))
+			return
+		}
 
-		d := meshcentral.GetDevices()
-		meshcentral.StopSocket()
+		ctx := cmd.Context()
+		client := newClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
 
-		filterAndSortDevices(&d)
+		d, err := fetchDevices(ctx, client)
+		client.Close()
+		pExit("Failed to list devices:", err)
 
-		printDevices(&d)
+		pExit("Failed to print devices:", printDevices(cmd, getSelector(cmd).apply(d)))
 	},
 }
 
@@ -46,24 +48,25 @@ var searchCmd = &cobra.Command{
 	Long:    ``,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		meshcentral.ApplySettings(
-			"",
-			0,
-			0,
-			"",
-			false,
-			false,
-		)
+		ctx := cmd.Context()
+		client := newClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
 
-		meshcentral.StartSocket()
+		d, err := fetchDevices(ctx, client)
+		client.Close()
+		pExit("Failed to list devices:", err)
 
-		d := meshcentral.GetDevices()
-		meshcentral.StopSocket()
+		nodeid := pickDevice(cmd, d)
 
-		filterAndSortDevices(&d)
-		nodeid := searchDevices(&d)
-
-		pterm.Println("Selected Node:", nodeid)
+		if getOutputFormat(cmd).name == "table" {
+			pterm.Println("Selected Node:", nodeid)
+			return
+		}
+		for _, device := range d {
+			if device.Id == nodeid {
+				pExit("Failed to print device:", printDevices(cmd, []meshctl.Device{device}))
+			}
+		}
 
 	},
 }
@@ -71,30 +74,28 @@ var searchCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(searchCmd)
-}
 
-func filterAndSortDevices(d *[]meshcentral.Device) {
-	// filter devices (remove offline devices)
-	devices := (*d)[:0]
-	for _, device := range *d {
-		if device.Pwr != 0 {
-			devices = append(devices, device)
-		}
-	}
-	// sort devices alphabetically by name
-	sort.Slice(devices, func(i, j int) bool {
-		return devices[i].Name < devices[j].Name
-	})
+	listCmd.Flags().BoolP("wide", "w", false, "Show device groups, domains, descriptions, tags, agent, consent and last connect time (same as -o wide)")
+	listCmd.Flags().Bool("cached", false, "List the devices cached by the last command instead of logging in")
+	addSelectorFlags(listCmd)
+	addSelectorFlags(searchCmd)
+}
 
-	*d = devices
+// selectDevice lets the user pick one of the devices chosen by the selector
+// flags of cmd interactively.
+func selectDevice(cmd *cobra.Command, client *meshctl.Client) string {
+	devices, err := fetchDevices(cmd.Context(), client)
+	pExit("Failed to list devices:", err)
+	return pickDevice(cmd, devices)
 }
 
-func searchDevices(d *[]meshcentral.Device) string {
+func searchDevices(d *[]meshctl.Device) string {
 	var options []string
 
 	// Calculate max widths for padding
 	maxNameLen := 0
 	maxHostLen := 0
+	maxIPLen := 0
 	for _, device := range *d {
 		displayName := device.DisplayName
 		if displayName == "" {
@@ -106,6 +107,9 @@ func searchDevices(d *[]meshcentral.Device) string {
 		if len(device.Name) > maxHostLen {
 			maxHostLen = len(device.Name)
 		}
+		if len(device.IP) > maxIPLen {
+			maxIPLen = len(device.IP)
+		}
 	}
 
 	// Ensure minimum column widths for headers
@@ -115,10 +119,13 @@ func searchDevices(d *[]meshcentral.Device) string {
 	if maxHostLen < 8 {
 		maxHostLen = 8
 	}
+	if maxIPLen < 10 {
+		maxIPLen = 10
+	}
 
 	// Create header for prompt
-	header := fmt.Sprintf("\n     %-*s  %-*s  %s\n",
-		maxNameLen, "NAME", maxHostLen, "HOSTNAME", "IP ADDRESS")
+	header := fmt.Sprintf("\n     %-*s  %-*s  %-*s  %s\n",
+		maxNameLen, "NAME", maxHostLen, "HOSTNAME", maxIPLen, "IP ADDRESS", "GROUP")
 
 	for i, device := range *d {
 		displayName := device.DisplayName
@@ -131,11 +138,11 @@ func searchDevices(d *[]meshcentral.Device) string {
 
 		var line string
 		if hostname != "" {
-			line = fmt.Sprintf("%-3d  %-*s  %-*s  %s",
-				i, maxNameLen, displayName, maxHostLen, hostname, device.IP)
+			line = fmt.Sprintf("%-3d  %-*s  %-*s  %-*s  %s",
+				i, maxNameLen, displayName, maxHostLen, hostname, maxIPLen, device.IP, groupName(device))
 		} else {
-			line = fmt.Sprintf("%-3d  %-*s  %s",
-				i, maxNameLen, displayName, device.IP)
+			line = fmt.Sprintf("%-3d  %-*s  %-*s  %s",
+				i, maxNameLen, displayName, maxIPLen, device.IP, groupName(device))
 		}
 
 		options = append(options, line)
@@ -159,21 +166,97 @@ func searchDevices(d *[]meshcentral.Device) string {
 	return nodeid
 }
 
-func printDevices(d *[]meshcentral.Device) {
-	listData := [][]string{}
-	listData = append(listData, []string{"Name", "Hostname", "IP", "OS"})
-	for _, device := range *d {
-		displayName := device.DisplayName
-		if displayName == "" {
-			displayName = "-"
+// groupName returns the name of the device's group, or its ID if the name
+// is unknown.
+func groupName(device meshctl.Device) string {
+	if device.MeshName != "" {
+		return device.MeshName
+	}
+	return device.MeshID
+}
+
+// Consent flags of a device, as MeshCentral numbers them
+const (
+	consentDesktopNotify = 1 << iota
+	consentTerminalNotify
+	consentFilesNotify
+	consentDesktopPrompt
+	consentTerminalPrompt
+	consentFilesPrompt
+	consentToolbar
+)
+
+// consentText describes the consent flags of a device, e.g.
+// "desktop:prompt files:notify", or "-" if none are set.
+func consentText(consent int) string {
+	var parts []string
+	for _, kind := range []struct {
+		name           string
+		notify, prompt int
+	}{
+		{"desktop", consentDesktopNotify, consentDesktopPrompt},
+		{"terminal", consentTerminalNotify, consentTerminalPrompt},
+		{"files", consentFilesNotify, consentFilesPrompt},
+	} {
+		switch {
+		case consent&kind.prompt != 0:
+			parts = append(parts, kind.name+":prompt")
+		case consent&kind.notify != 0:
+			parts = append(parts, kind.name+":notify")
+		}
+	}
+	if consent&consentToolbar != 0 {
+		parts = append(parts, "toolbar")
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " ")
+}
+
+// printDevices prints devices in the format selected with --output.
+func printDevices(cmd *cobra.Command, devices []meshctl.Device) error {
+	rows := func(wide bool) [][]string {
+		header := []string{"Name", "Hostname", "IP", "OS"}
+		if wide {
+			header = []string{"Name", "Hostname", "Group", "Domain", "IP", "OS", "Description", "Tags", "Agent", "Consent", "Last Connect", "ID"}
+		}
+		listData := [][]string{header}
+		for _, device := range devices {
+			displayName := device.DisplayName
+			if displayName == "" {
+				displayName = "-"
+			}
+			row := []string{
+				displayName,
+				device.Name,
+				device.IP,
+				device.OS,
+			}
+			if wide {
+				lastConnect := "-"
+				if !device.LastConnect.IsZero() {
+					lastConnect = device.LastConnect.Local().Format("2006-01-02 15:04")
+				}
+				row = []string{
+					displayName,
+					device.Name,
+					groupName(device),
+					device.Domain,
+					device.IP,
+					device.OS,
+					device.Description,
+					strings.Join(device.Tags, ","),
+					fmt.Sprintf("v%d", device.AgentVersion),
+					consentText(device.Consent),
+					lastConnect,
+					device.Id,
+				}
+			}
+			listData = append(listData, row)
 		}
-		listData = append(listData, []string{
-			displayName,
-			device.Name,
-			device.IP,
-			device.OS,
-		})
+		return listData
 	}
 
-	pterm.DefaultTable.WithHasHeader().WithData(listData).Render()
+	return printItems(cmd, devices, rows, pterm.DefaultTable.WithHasHeader())
 }
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// outputFormats lists the values of --output, besides template=...
+var outputFormats = []string{"table", "wide", "json", "yaml", "csv"}
+
+// outputFormat is the format selected with --output. template is set for
+// template=..., which is executed once per item.
+type outputFormat struct {
+	name     string
+	template *template.Template
+}
+
+// parseOutputFormat parses the value of --output.
+func parseOutputFormat(s string) (outputFormat, error) {
+	if text, ok := strings.CutPrefix(s, "template="); ok {
+		t, err := template.New("output").Parse(text)
+		if err != nil {
+			return outputFormat{}, fmt.Errorf("invalid output template: %w", err)
+		}
+		return outputFormat{name: "template", template: t}, nil
+	}
+	for _, name := range outputFormats {
+		if s == name {
+			return outputFormat{name: name}, nil
+		}
+	}
+	return outputFormat{}, fmt.Errorf("unknown output format %q, use %s or template=...", s, strings.Join(outputFormats, ", "))
+}
+
+// getOutputFormat returns the format selected with --output, where a
+// command's --wide flag stands for -o wide.
+func getOutputFormat(cmd *cobra.Command) outputFormat {
+	s, _ := cmd.Flags().GetString("output")
+	format, err := parseOutputFormat(s)
+	if err != nil {
+		pExit("Invalid --output:", usageError{err})
+	}
+	if wide, _ := cmd.Flags().GetBool("wide"); wide && format.name == "table" {
+		format.name = "wide"
+	}
+	return format
+}
+
+// printItems prints items in the format selected with --output. rows
+// renders the table, header first, for the table and csv formats; with wide
+// set it includes the extra columns of the wide format, which csv uses too.
+// table is the printer used for the table formats. Everything is written to
+// the command's output, stdout by default.
+func printItems[T any](cmd *cobra.Command, items []T, rows func(wide bool) [][]string, table *pterm.TablePrinter) error {
+	if items == nil {
+		// Scripts expect an empty list rather than null
+		items = []T{}
+	}
+
+	out := cmd.OutOrStdout()
+	format := getOutputFormat(cmd)
+	switch format.name {
+	case "table":
+		return table.WithWriter(out).WithData(rows(false)).Render()
+	case "wide":
+		return table.WithWriter(out).WithData(rows(true)).Render()
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case "yaml":
+		return printYAML(out, items)
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.WriteAll(rows(true))
+		return writer.Error()
+	case "template":
+		for _, item := range items {
+			var buf bytes.Buffer
+			if err := format.template.Execute(&buf, item); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+			out.Write(buf.Bytes())
+		}
+	}
+	return nil
+}
+
+// printYAML writes v to w as YAML with the same keys and order as its JSON.
+func printYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// JSON is YAML, decoding it into a node keeps the order of the keys
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	clearStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// clearStyle drops the flow style and quoting inherited from JSON, the
+// encoder still quotes strings that would read as another type.
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
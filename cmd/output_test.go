@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+var outputDevices = []meshctl.Device{
+	{
+		Id: "node//web", Name: "web01", DisplayName: "Web", OS: "Ubuntu 24.04", IP: "10.0.0.5",
+		MeshID: "mesh//office", MeshName: "Office", Domain: "corp", Description: "Intranet", Tags: []string{"prod", "http"},
+		AgentVersion: 2, AgentType: 6, Consent: consentDesktopPrompt | consentFilesNotify, LastConnect: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	},
+	{Id: "node//db", Name: "db01", MeshID: "mesh//office"},
+}
+
+// outputCommand returns a command with the --output and --wide flags set to
+// format and wide, writing its output to out.
+func outputCommand(t *testing.T, format string, wide bool, out *bytes.Buffer) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output", "table", "")
+	cmd.Flags().Bool("wide", false, "")
+	cmd.Flags().Set("output", format)
+	if wide {
+		cmd.Flags().Set("wide", "true")
+	}
+	cmd.SetOut(out)
+	return cmd
+}
+
+func TestPrintDevicesJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := printDevices(outputCommand(t, "json", false, &out), outputDevices); err != nil {
+		t.Fatal("printDevices:", err)
+	}
+	for _, key := range []string{`"id": "node//web"`, `"display_name": "Web"`, `"mesh_id": "mesh//office"`, `"last_connect": "2026-01-02T03:04:05Z"`} {
+		if !strings.Contains(out.String(), key) {
+			t.Errorf("JSON output lacks %s:\n%s", key, out.String())
+		}
+	}
+
+	var devices []meshctl.Device
+	if err := json.Unmarshal(out.Bytes(), &devices); err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].DisplayName != "Web" || !devices[0].LastConnect.Equal(outputDevices[0].LastConnect) {
+		t.Errorf("JSON output decodes to %+v", devices)
+	}
+
+	// No devices are an empty list
+	out.Reset()
+	printDevices(outputCommand(t, "json", false, &out), nil)
+	if got := strings.TrimSpace(out.String()); got != "[]" {
+		t.Errorf("JSON output of no devices = %s, want []", got)
+	}
+}
+
+func TestPrintDevicesYAML(t *testing.T) {
+	var out bytes.Buffer
+	if err := printDevices(outputCommand(t, "yaml", false, &out), outputDevices); err != nil {
+		t.Fatal("printDevices:", err)
+	}
+	want := `- id: node//web
+  name: web01
+  display_name: Web
+  os: Ubuntu 24.04
+  ip: 10.0.0.5
+`
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("YAML output =\n%s\nwant it to start with\n%s", out.String(), want)
+	}
+	if !strings.Contains(out.String(), "  tags:\n    - prod\n    - http\n") {
+		t.Errorf("YAML output lacks the tags:\n%s", out.String())
+	}
+}
+
+func TestPrintDevicesCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := printDevices(outputCommand(t, "csv", false, &out), outputDevices); err != nil {
+		t.Fatal("printDevices:", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("CSV output has %d records, want a header and 2 devices", len(records))
+	}
+	// csv has the columns of the wide format
+	header, web := records[0], records[1]
+	for column, want := range map[string]string{"Name": "Web", "Group": "Office", "Tags": "prod,http", "ID": "node//web"} {
+		i := slices.Index(header, column)
+		if i < 0 {
+			t.Errorf("CSV header %q lacks %s", header, column)
+			continue
+		}
+		if web[i] != want {
+			t.Errorf("CSV column %s = %q, want %q", column, web[i], want)
+		}
+	}
+}
+
+func TestPrintDevicesWide(t *testing.T) {
+	var out bytes.Buffer
+	if err := printDevices(outputCommand(t, "table", true, &out), outputDevices); err != nil {
+		t.Fatal("printDevices:", err)
+	}
+	for _, want := range []string{"Domain", "corp", "Description", "Intranet", "Consent", "desktop:prompt files:notify", "v2", "node//web"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("wide output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "type 6") {
+		t.Errorf("wide output shows the agent type number:\n%s", out.String())
+	}
+}
+
+func TestConsentText(t *testing.T) {
+	tests := []struct {
+		consent int
+		want    string
+	}{
+		{consent: 0, want: "-"},
+		{consent: consentDesktopNotify, want: "desktop:notify"},
+		{consent: consentDesktopNotify | consentDesktopPrompt, want: "desktop:prompt"},
+		{consent: consentTerminalPrompt | consentFilesNotify | consentToolbar, want: "terminal:prompt files:notify toolbar"},
+	}
+	for _, tt := range tests {
+		if got := consentText(tt.consent); got != tt.want {
+			t.Errorf("consentText(%d) = %q, want %q", tt.consent, got, tt.want)
+		}
+	}
+}
+
+func TestPrintDevicesTemplate(t *testing.T) {
+	var out bytes.Buffer
+	if err := printDevices(outputCommand(t, "template={{.Id}} {{.IP}}", false, &out), outputDevices); err != nil {
+		t.Fatal("printDevices:", err)
+	}
+	if got, want := out.String(), "node//web 10.0.0.5\nnode//db \n"; got != want {
+		t.Errorf("template output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	if err := printDevices(outputCommand(t, "template={{.Missing}}", false, &out), outputDevices); err == nil {
+		t.Error("template with an unknown field succeeded")
+	}
+}
+
+func TestPrintProfilesHidePassword(t *testing.T) {
+	profiles := []config.Profile{{
+		Name:     "home",
+		Server:   "mesh.example.com",
+		Username: "admin",
+		Password: "hunter2",
+		Tunnels:  map[string][]config.Tunnel{"default": {{Node: "web01", LocalPort: 8080, RemotePort: 80}}},
+	}}
+
+	tests := []struct {
+		format string
+		wide   bool
+	}{
+		{format: "table"},
+		{format: "table", wide: true},
+		{format: "json"},
+		{format: "yaml"},
+		{format: "csv"},
+		{format: "template={{.Name}} {{.Password}}"},
+		{format: "template={{printf \"%#v\" .}}"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := printProfileTable(outputCommand(t, tt.format, tt.wide, &out), profiles); err != nil {
+			t.Errorf("printProfileTable(%s): %v", tt.format, err)
+			continue
+		}
+		if !strings.Contains(out.String(), "home") {
+			t.Errorf("%s output lacks the profile:\n%s", tt.format, out.String())
+		}
+		if strings.Contains(out.String(), "hunter2") {
+			t.Errorf("%s output shows the password:\n%s", tt.format, out.String())
+		}
+	}
+	if profiles[0].Password != "hunter2" {
+		t.Error("printProfileTable cleared the password of its argument")
+	}
+}
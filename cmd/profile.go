@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"slices"
 	"strconv"
 	"strings"
 
@@ -37,7 +38,9 @@ var profileListCmd = &cobra.Command{
 	Short:   "List all profiles",
 	Long:    ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		printProfileTable(config.GetProfiles())
+		profiles, err := config.GetProfiles()
+		pExit("Failed to read profiles:", err)
+		pExit("Failed to print profiles:", printProfileTable(cmd, profiles))
 	},
 }
 
@@ -47,7 +50,7 @@ var profileRmCmd = &cobra.Command{
 	Short:   "Remove a profile",
 	Long:    ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		config.RemoveProfile(args[0])
+		pExit("Failed to remove profile:", config.RemoveProfile(args[0]))
 		pterm.Info.Println("Removed profile: ", args[0])
 	},
 }
@@ -64,9 +67,10 @@ var profileAddCmd = &cobra.Command{
 		password, _ := cmd.Flags().GetString("password")
 		isDefault, _ := cmd.Flags().GetBool("default")
 
-		p := config.AddProfile(name, isDefault, server, username, password)
+		p, err := config.AddProfile(name, isDefault, server, username, password)
+		pExit("Failed to add profile:", err)
 
-		printProfileTable([]config.Profile{*p})
+		pExit("Failed to print profile:", printProfileTable(cmd, []config.Profile{*p}))
 	},
 }
 
@@ -90,30 +94,46 @@ func init() {
 
 }
 
-func printProfileTable(profiles []config.Profile) {
-	// print profiles in a table
-	profileData := [][]string{}
+// printProfileTable prints profiles in the format selected with --output.
+// Their passwords are left out, a template could print them otherwise.
+func printProfileTable(cmd *cobra.Command, profiles []config.Profile) error {
+	profiles = slices.Clone(profiles)
+	for i := range profiles {
+		profiles[i].Password = ""
+	}
+
+	rows := func(wide bool) [][]string {
+		// print profiles in a table
+		profileData := [][]string{}
 
-	// add header
-	profileData = append(profileData, []string{"Name", "Server", "Username", "IsDefault"})
+		// add header
+		header := []string{"Name", "Server", "Username", "IsDefault"}
+		if wide {
+			header = append(header, "TunnelSets")
+		}
+		profileData = append(profileData, header)
 
-	// add profile data
-	for _, p := range profiles {
-		d := config.GetDefaultProfileName()
-		/*isDefault := "false"
-		if strings.Compare(p.Name, d) == 0 {
-			isDefault = "true"
-			}*/
+		// add profile data
+		for _, p := range profiles {
+			d := config.GetDefaultProfileName()
+			/*isDefault := "false"
+			if strings.Compare(p.Name, d) == 0 {
+				isDefault = "true"
+				}*/
 
-		profileData = append(
-			profileData,
-			[]string{
+			row := []string{
 				p.Name,
 				p.Server,
 				p.Username,
 				strconv.FormatBool((strings.Compare(p.Name, d) == 0)),
-			},
-		)
+			}
+			if wide {
+				row = append(row, strings.Join(p.TunnelSetNames(), " "))
+			}
+			profileData = append(profileData, row)
+		}
+		return profileData
 	}
-	pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(profileData).Render()
+
+	return printItems(cmd, profiles, rows, pterm.DefaultTable.WithHasHeader().WithBoxed())
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// errUnknownDevice is returned by resolveNode when no device matches.
+var errUnknownDevice = errors.New("no device with that name, hostname or IP")
+
+// nodeResolver turns node IDs, device names, hostnames, IPs or aliases of
+// the active profile into node IDs. The device list is only fetched if a
+// device has to be looked up and the device cache, if younger than
+// cacheTTL, has no single match.
+type nodeResolver struct {
+	client   *meshctl.Client
+	profile  config.Profile
+	cacheTTL time.Duration
+	devices  []meshctl.Device
+	loaded   bool
+}
+
+// newNodeResolver returns a resolver on client for the aliases of the
+// active profile, using cached devices up to cacheTTL old.
+func newNodeResolver(client *meshctl.Client, cacheTTL time.Duration) *nodeResolver {
+	p, _ := config.GetDefaultProfile()
+	return &nodeResolver{client: client, profile: p, cacheTTL: cacheTTL}
+}
+
+// resolveNode returns the node ID for node, which is either a node ID
+// ("node//..."), an alias of the profile, or the name, hostname or IP of
+// exactly one device.
+func (r *nodeResolver) resolveNode(ctx context.Context, node string) (string, error) {
+	if alias, ok := r.profile.Alias(node); ok {
+		node = alias
+	}
+	if strings.HasPrefix(node, "node/") {
+		return node, nil
+	}
+
+	if !r.loaded && r.cacheTTL > 0 {
+		cache, err := readDeviceCache()
+		if err == nil && time.Since(cache.Updated) < r.cacheTTL {
+			// A renamed or new device may match too, only trust a single match
+			if matches := matchDevices(cache.Devices, node); len(matches) == 1 {
+				return matches[0].Id, nil
+			}
+		}
+	}
+
+	if !r.loaded {
+		devices, err := fetchDevices(ctx, r.client)
+		if err != nil {
+			return "", err
+		}
+		r.devices = devices
+		r.loaded = true
+	}
+
+	matches := matchDevices(r.devices, node)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", errUnknownDevice, node)
+	case 1:
+		return matches[0].Id, nil
+	}
+	var candidates []string
+	for _, d := range matches {
+		candidates = append(candidates, fmt.Sprintf("%s (%s, %s) %s in %s", d.DisplayName, d.Name, d.IP, d.Id, groupName(d)))
+	}
+	return "", fmt.Errorf("device %q is ambiguous, %d devices match: %s", node, len(matches), strings.Join(candidates, "; "))
+}
+
+// matchDevices returns the devices whose name or hostname is node, or
+// whose IP is node if it is an address.
+func matchDevices(devices []meshctl.Device, node string) []meshctl.Device {
+	addr, err := netip.ParseAddr(node)
+	isAddr := err == nil
+
+	var matches []meshctl.Device
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, node) || strings.EqualFold(d.DisplayName, node) ||
+			(isAddr && deviceAddr(d) == addr.Unmap()) {
+			matches = append(matches, d)
+		}
+	}
+	return matches
+}
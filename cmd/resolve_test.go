@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func TestResolveNode(t *testing.T) {
+	resolver := &nodeResolver{
+		profile: config.Profile{Aliases: map[string]string{
+			"db": "db01",
+			"gw": "node//gateway",
+		}},
+		devices: []meshctl.Device{
+			{Id: "node//web", Name: "web01", DisplayName: "Web", IP: "10.0.0.5"},
+			{Id: "node//db", Name: "db01", DisplayName: "Database", IP: "10.0.0.6"},
+			{Id: "node//nas1", Name: "nas", DisplayName: "NAS 1", IP: "10.0.0.9"},
+			{Id: "node//nas2", Name: "nas", DisplayName: "NAS 2", IP: "10.0.0.9"},
+		},
+		loaded: true,
+	}
+
+	tests := []struct {
+		node    string
+		want    string
+		wantErr string
+	}{
+		{node: "web01", want: "node//web"},
+		{node: "WEB", want: "node//web"},
+		{node: "Database", want: "node//db"},
+		{node: "10.0.0.5", want: "node//web"},
+		{node: "::ffff:10.0.0.6", want: "node//db"},
+		{node: "node//unknown", want: "node//unknown"},
+		{node: "db", want: "node//db"},
+		{node: "GW", want: "node//gateway"},
+		{node: "nas", wantErr: "ambiguous, 2 devices match"},
+		{node: "10.0.0.9", wantErr: "ambiguous, 2 devices match"},
+		{node: "mail01", wantErr: errUnknownDevice.Error()},
+	}
+	for _, tt := range tests {
+		got, err := resolver.resolveNode(context.Background(), tt.node)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveNode(%q) = %q, %v, want an error containing %q", tt.node, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolveNode(%q) = %q, %v, want %q", tt.node, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSSHTarget(t *testing.T) {
+	resolver := &nodeResolver{
+		devices: []meshctl.Device{{Id: "node//web", Name: "web01", IP: "10.0.0.5"}},
+		loaded:  true,
+	}
+	pick := func() string { return "node//picked" }
+
+	// A device is the node itself
+	node, target := resolveSSHTarget(context.Background(), resolver, "web01", pick)
+	if node != "node//web" || target != "" {
+		t.Errorf("resolveSSHTarget(web01) = %q, %q, want node//web and no target", node, target)
+	}
+
+	// Anything else is reached through a picked node
+	node, target = resolveSSHTarget(context.Background(), resolver, "192.168.1.1", pick)
+	if node != "node//picked" || target != "192.168.1.1" {
+		t.Errorf("resolveSSHTarget(192.168.1.1) = %q, %q, want node//picked and target 192.168.1.1", node, target)
+	}
+	if _, err := resolver.resolveNode(context.Background(), "192.168.1.1"); !errors.Is(err, errUnknownDevice) {
+		t.Errorf("resolveNode(192.168.1.1) = %v, want errUnknownDevice", err)
+	}
+}
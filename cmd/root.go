@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/lexpaval/mesh-central-client-go/internal/config"
-	"github.com/lexpaval/mesh-central-client-go/internal/meshcentral"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,6 +21,11 @@ var rootCmd = &cobra.Command{
 	Short: "Simple tool to interact with the MeshCentral API",
 	Long:  ``,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Completion must never prompt, completeNodes loads the config itself
+		if isCompletionCmd(cmd) {
+			return
+		}
+
 		c, _ := cmd.Flags().GetString("config")
 		if c != "" {
 			viper.SetConfigFile(c)
@@ -24,15 +33,15 @@ var rootCmd = &cobra.Command{
 			viper.SetConfigFile(config.DefaultConfigPath)
 		}
 
-		if token, _ := cmd.Flags().GetString("token"); token != "" {
-			meshcentral.ApplyAuth(token, false, false)
-		}
-
 		// create config file if necessary
 		initializeSetup()
 
+		// Fail on invalid output or selector flags before logging in
+		getOutputFormat(cmd)
+		getSelector(cmd)
+
 		// Load the config file
-		config.LoadConfig()
+		pExit("Failed to load config:", config.LoadConfig())
 
 		// Migrate plaintext passwords to keyring
 		if err := migratePasswords(); err != nil {
@@ -41,7 +50,7 @@ var rootCmd = &cobra.Command{
 
 		p, _ := cmd.Flags().GetString("profile")
 		if p != "" {
-			config.SetDefaultProfile(p, false)
+			pExit("Failed to select profile:", config.SetDefaultProfile(p, false))
 		}
 
 	},
@@ -78,9 +87,14 @@ func migratePasswords() error {
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Cancel the running command on ctrl-c so connections are closed cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Commands handle their own failures, cobra only reports bad usage
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
@@ -92,13 +106,48 @@ func init() {
 	rootCmd.PersistentFlags().StringP("config", "C", "", "Alternate configuration file to use")
 	rootCmd.PersistentFlags().StringP("profile", "P", "", "Override the active profile")
 	rootCmd.PersistentFlags().StringP("token", "t", "", "2FA token")
+	rootCmd.PersistentFlags().String("control", "", "Control socket of mcc route/up/daemon (default: per profile in the runtime directory)")
+	rootCmd.PersistentFlags().Bool("no-daemon", false, "Log in again instead of using a running mcc daemon")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "Output format of list, search and profile list: table, wide, json, yaml, csv or template='{{.Id}}'")
+	rootCmd.PersistentFlags().Duration("timeout", 30*time.Second, "Timeout for each request to the server (0 to disable)")
+	rootCmd.PersistentFlags().Duration("cache-ttl", defaultCacheTTL, "Resolve device names from devices cached this recently (0 to disable)")
+	rootCmd.PersistentFlags().Bool("refresh", false, "Fetch the devices instead of using the device cache")
 }
 
-func pExit(s string, err error) {
-	if err != nil {
-		pterm.Error.Println(s, err)
-		os.Exit(1)
+// isCompletionCmd reports whether cmd completes the command line or prints
+// a completion script.
+func isCompletionCmd(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
 	}
+	return cmd.HasParent() && cmd.Parent().Name() == "completion"
+}
+
+// newClient returns a client for the active profile, configured from the
+// command's flags.
+func newClient(cmd *cobra.Command) *meshctl.Client {
+	p, err := config.GetDefaultProfile()
+	pExit("No active profile:", err)
+	client := meshctl.NewClient(p.Server, p.Username, p.Password)
+	client.TokenPrompt = func(ae meshctl.AuthError) bool {
+		return promptForToken(client, ae)
+	}
+	if token, _ := cmd.Flags().GetString("token"); token != "" {
+		client.SetToken(token, false, false)
+	}
+	client.Timeout, _ = cmd.Flags().GetDuration("timeout")
+	client.Insecure, _ = cmd.Flags().GetBool("insecure")
+	client.Debug, _ = cmd.Flags().GetBool("debug")
+	return client
+}
+
+// newForwardingClient is newClient for commands that run forwards until
+// interrupted, which keep minting tunnels across server restarts.
+func newForwardingClient(cmd *cobra.Command) *meshctl.Client {
+	client := newClient(cmd)
+	client.AutoReconnect = true
+	return client
 }
 
 func initializeSetup() {
@@ -118,8 +167,7 @@ func initializeSetup() {
 
 		err := config.CreateConfig(server, username, password)
 		if err != nil {
-			pterm.Error.Println("Error creating config file:", err)
-			os.Exit(1)
+			pExit("Error creating config file:", err)
 		}
 	}
 }
@@ -6,109 +6,308 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 
-	"github.com/lexpaval/mesh-central-client-go/internal/meshcentral"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
 )
 
 var routeCmd = &cobra.Command{
 	Use:     "route",
 	Aliases: []string{"r"},
-	Short:   "Forward TCP traffic to specified Node",
+	Short:   "Forward TCP and UDP traffic to specified Node",
 	Long:    ``,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		bindAddress, _ := cmd.Flags().GetString("bind-address")
+		specs, _ := cmd.Flags().GetStringArray("bind-address")
+		udpSpecs, _ := cmd.Flags().GetStringArray("udp")
 		nodeID, _ := cmd.Flags().GetString("nodeid")
-		debug, _ := cmd.Flags().GetBool("debug")
-		insecure, _ := cmd.Flags().GetBool("insecure")
+		client := newForwardingClient(cmd)
+		client.UDPIdleTimeout, _ = cmd.Flags().GetDuration("udp-timeout")
 
-		localport, target, remoteport, err := parseBindAddress(bindAddress)
-		if err != nil {
-			fmt.Println("Error parsing bind address: ", err)
+		if len(specs) == 0 && len(udpSpecs) == 0 {
+			pExit("Error parsing bind address:", usageError{errors.New("at least one -L or -U is required")})
+		}
+
+		if path := daemonSocket(cmd); path != "" {
+			routeDaemon(cmd, path, specs, udpSpecs, nodeID)
 			return
 		}
 
-		meshcentral.ApplySettings(
-			nodeID,
-			remoteport,
-			localport,
-			target,
-			insecure,
-			debug,
-		)
+		var forwards []meshctl.Forward
+		for _, spec := range specs {
+			f, err := parseForward(spec)
+			if err != nil {
+				pExit(fmt.Sprintf("Error parsing bind address %q:", spec), usageError{err})
+			}
+			forwards = append(forwards, f)
+		}
+		for _, spec := range udpSpecs {
+			f, err := parseForward(spec)
+			if err == nil && f.LocalPath != "" {
+				err = errors.New("UDP needs a local port")
+			}
+			if err != nil {
+				pExit(fmt.Sprintf("Error parsing UDP bind address %q:", spec), usageError{err})
+			}
+			f.UDP = true
+			forwards = append(forwards, f)
+		}
 
-		meshcentral.StartSocket()
+		ctx := cmd.Context()
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
 
-		if nodeID == "" {
-			devices := meshcentral.GetDevices()
-			filterAndSortDevices(&devices)
-			nodeID = searchDevices(&devices)
+		gatewayPorts, _ := cmd.Flags().GetBool("gateway-ports")
+		allowGatewayPorts(forwards, gatewayPorts)
 
-			meshcentral.ApplySettings(
-				nodeID,
-				remoteport,
-				localport,
-				target,
-				insecure,
-				debug,
-			)
+		// Forwards without their own node go to -i, or to the device picked
+		// once interactively
+		resolver := newNodeResolver(client, cacheTTL(cmd))
+		for i := range forwards {
+			if forwards[i].NodeID != "" {
+				nodeID, err := resolver.resolveNode(ctx, forwards[i].NodeID)
+				pExit("Failed to resolve node:", err)
+				forwards[i].NodeID = nodeID
+				continue
+			}
+			if nodeID == "" {
+				nodeID = selectDevice(cmd, client)
+			}
+			forwards[i].NodeID = nodeID
 		}
 
-		ready := make(chan struct{})
-		meshcentral.StartRouter(ready)
+		runForwards(cmd, client, forwards)
 	},
 }
 
+// routeDaemon hands the forwards to the mcc daemon at path, where they keep
+// running after we return.
+func routeDaemon(cmd *cobra.Command, path string, specs []string, udpSpecs []string, nodeID string) {
+	gatewayPorts, _ := cmd.Flags().GetBool("gateway-ports")
+	requests := tunnelRequests(specs, udpSpecs, nodeID, gatewayPorts)
+	for i := range requests {
+		f, err := parseForward(requests[i].Spec)
+		if err != nil {
+			pExit(fmt.Sprintf("Error parsing bind address %q:", requests[i].Spec), usageError{err})
+		}
+		if f.NodeID == "" && requests[i].Node == "" {
+			// Picked once for all forwards without their own node
+			nodeID = daemonSelectDevice(cmd, path)
+			for j := range requests {
+				requests[j].Node = nodeID
+			}
+		}
+	}
+
+	ids := addTunnels(path, requests)
+	fmt.Printf("Forwarding in mcc daemon, stop with: mcc tunnels rm %s\n", strings.Join(ids, " "))
+}
+
+// allowGatewayPorts makes forwards without an explicit bind address listen
+// on all interfaces, if enabled, like OpenSSH's GatewayPorts.
+func allowGatewayPorts(forwards []meshctl.Forward, enabled bool) {
+	if !enabled {
+		return
+	}
+	for i := range forwards {
+		if forwards[i].BindAddress == "" && forwards[i].LocalPath == "" {
+			forwards[i].BindAddress = "*"
+		}
+	}
+}
+
+// runForwards runs forwards until interrupted, reporting their traffic as
+// selected by the stats flags, and exits on failure. While running, the
+// forwards can be managed with mcc tunnels through the control socket.
+func runForwards(cmd *cobra.Command, client *meshctl.Client, forwards []meshctl.Forward) {
+	ctx := cmd.Context()
+	server := newControlServer(ctx, client)
+	server.cacheTTL = cacheTTL(cmd)
+	for _, f := range forwards {
+		id, err := server.add(f)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			pExit("Failed to forward:", err)
+		}
+		announceForward(client, id)
+	}
+
+	path, err := controlSocketPath(cmd)
+	if err == nil {
+		err = server.listen(path)
+	}
+	if err != nil {
+		pterm.Warning.Println("Control socket unavailable, mcc tunnels cannot manage these forwards:", err)
+	}
+
+	fmt.Println("Press ctrl-c to exit.")
+	stopStats := watchStats(cmd, client)
+	<-ctx.Done()
+	server.wait()
+	stopStats()
+}
+
+// announceForward prints where the forward with the given ID listens.
+func announceForward(client *meshctl.Client, id string) {
+	for _, stats := range client.Stats() {
+		f := stats.Forward
+		if f.Name != id {
+			continue
+		}
+		switch {
+		case f.LocalPath != "":
+			fmt.Printf("Redirecting local socket %s to remote port %d.\n", f.LocalPath, f.RemotePort)
+		case f.UDP:
+			fmt.Printf("Redirecting UDP %s to remote port %d.\n", stats.LocalAddr, f.RemotePort)
+		default:
+			fmt.Printf("Redirecting %s to remote port %d.\n", stats.LocalAddr, f.RemotePort)
+		}
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(routeCmd)
 
-	routeCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID")
-	routeCmd.Flags().StringP("bind-address", "L", "", "localport:[target:]remoteport")
+	routeCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID, device name, hostname, IP or alias")
+	routeCmd.Flags().StringArrayP("bind-address", "L", nil, "[node=][bindaddr:]localport|socketpath:[target:]remoteport, repeatable")
+	routeCmd.Flags().StringArrayP("udp", "U", nil, "[node=][bindaddr:]localport:[target:]remoteport for UDP, repeatable")
+	routeCmd.Flags().BoolP("gateway-ports", "g", false, "Allow other hosts to connect to forwards without a bind address")
+	routeCmd.Flags().Duration("udp-timeout", meshctl.DefaultUDPIdleTimeout, "Close a UDP session after this long without traffic")
+	addStatsFlags(routeCmd)
+	addSelectorFlags(routeCmd)
+	addNodeCompletion(routeCmd)
 	routeCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
 	routeCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
 }
 
-// parseBindAddress parses a bind address string in the format:
-// "localport:target:remoteport" or "localport:remoteport" or just "remoteport"
-func parseBindAddress(s string) (localPort int, target string, remotePort int, err error) {
-	parts := strings.Split(s, ":")
+// parseForward parses a -L spec, optionally prefixed with the node it goes
+// through: "node//abc=8080:80". The node is split off at the last "=",
+// which never appears in the bind address itself. The local port may be a
+// unix socket path instead: "/run/user/1000/db.sock:5432".
+func parseForward(spec string) (meshctl.Forward, error) {
+	var f meshctl.Forward
+	if i := strings.LastIndex(spec, "="); i >= 0 {
+		f.NodeID = spec[:i]
+		spec = spec[i+1:]
+		if f.NodeID == "" {
+			return f, errors.New("empty node before '='")
+		}
+	}
+
+	// A unix socket path takes the place of the local port
+	if strings.HasPrefix(spec, "/") || strings.HasPrefix(spec, "./") {
+		i := strings.Index(spec, ":")
+		if i < 0 {
+			return f, errors.New("missing remote port after socket path")
+		}
+		f.LocalPath = spec[:i]
+		spec = spec[i+1:]
+	}
+
+	var err error
+	f.BindAddress, f.LocalPort, f.Target, f.RemotePort, err = parseBindAddress(spec)
+	if err == nil && f.LocalPath != "" && (f.LocalPort != 0 || f.BindAddress != "") {
+		return f, errors.New("a socket path replaces the bind address and local port")
+	}
+	return f, err
+}
+
+// parseBindAddress parses a bind address string in the format
+// "bindaddr:localport:target:remoteport", "localport:target:remoteport",
+// "bindaddr:localport:remoteport", "localport:remoteport",
+// "target:remoteport" or just "remoteport". IPv6 addresses are written in
+// brackets, as with OpenSSH. A bind address of "*" or "" (":8080:...")
+// means all interfaces.
+func parseBindAddress(s string) (bindAddress string, localPort int, target string, remotePort int, err error) {
+	invalid := errors.New("invalid bind address format")
+
+	parts, err := splitHostPorts(s)
+	if err != nil {
+		return "", 0, "", 0, err
+	}
 	switch len(parts) {
 	case 1:
-		remotePort, err = strconv.Atoi(parts[0])
-		if err != nil {
-			return 0, "", 0, errors.New("invalid bind address format")
-		}
 	case 2:
 		if isDigits(parts[0]) {
 			localPort, _ = strconv.Atoi(parts[0])
 		} else {
 			target = parts[0]
 		}
-		remotePort, err = strconv.Atoi(parts[1])
-		if err != nil {
-			return 0, "", 0, errors.New("invalid bind address format")
-		}
 	case 3:
-		if !isDigits(parts[0]) {
-			return 0, "", 0, errors.New("invalid bind address format")
+		switch {
+		case isDigits(parts[0]):
+			localPort, _ = strconv.Atoi(parts[0])
+			target = parts[1]
+		case isDigits(parts[1]):
+			bindAddress = parts[0]
+			if bindAddress == "" {
+				bindAddress = "*"
+			}
+			localPort, _ = strconv.Atoi(parts[1])
+		default:
+			return "", 0, "", 0, invalid
 		}
-		localPort, _ = strconv.Atoi(parts[0])
-		target = parts[1]
-		remotePort, err = strconv.Atoi(parts[2])
-		if err != nil {
-			return 0, "", 0, errors.New("invalid bind address format")
+	case 4:
+		if !isDigits(parts[1]) {
+			return "", 0, "", 0, invalid
 		}
+		bindAddress = parts[0]
+		if bindAddress == "" {
+			bindAddress = "*"
+		}
+		localPort, _ = strconv.Atoi(parts[1])
+		target = parts[2]
 	default:
-		return 0, "", 0, errors.New("invalid bind address format")
+		return "", 0, "", 0, invalid
+	}
+
+	remotePort, err = strconv.Atoi(parts[len(parts)-1])
+	if err != nil || remotePort <= 0 || remotePort > 65535 || localPort > 65535 {
+		return "", 0, "", 0, invalid
 	}
 
-	// If target is "127.0.0.1", set to nothing
-	if target == "127.0.0.1" {
+	// The relay reaches the node itself without a target
+	if target == "127.0.0.1" || target == "::1" || target == "localhost" {
 		target = ""
 	}
 
-	return localPort, target, remotePort, nil
+	return bindAddress, localPort, target, remotePort, nil
+}
+
+// splitHostPorts splits s at the colons outside of brackets and removes the
+// brackets around IPv6 addresses: "[::1]:8080:22" gives "::1", "8080", "22".
+func splitHostPorts(s string) ([]string, error) {
+	var parts []string
+	for s != "" {
+		var part string
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, errors.New("missing ']' in address")
+			}
+			part, s = s[1:end], s[end+1:]
+			if s != "" && !strings.HasPrefix(s, ":") {
+				return nil, errors.New("expected ':' after ']'")
+			}
+		} else if i := strings.Index(s, ":"); i >= 0 {
+			part, s = s[:i], s[i:]
+		} else {
+			part, s = s, ""
+		}
+		parts = append(parts, part)
+
+		if strings.HasPrefix(s, ":") {
+			s = s[1:]
+			if s == "" {
+				// A trailing colon leaves an empty last part
+				parts = append(parts, "")
+			}
+		}
+	}
+	return parts, nil
 }
 
 func isDigits(s string) bool {
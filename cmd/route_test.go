@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func TestSplitHostPorts(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{s: "22", want: []string{"22"}},
+		{s: "8080:22", want: []string{"8080", "22"}},
+		{s: "[::1]:8080:22", want: []string{"::1", "8080", "22"}},
+		{s: "[::1]:8080:[fe80::1]:80", want: []string{"::1", "8080", "fe80::1", "80"}},
+		{s: ":8080::80", want: []string{"", "8080", "", "80"}},
+		{s: "8080:", want: []string{"8080", ""}},
+		{s: "[::1", wantErr: true},
+		{s: "[::1]8080:22", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitHostPorts(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitHostPorts(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitHostPorts(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseBindAddress(t *testing.T) {
+	type result struct {
+		bind   string
+		local  int
+		target string
+		remote int
+	}
+	tests := []struct {
+		s       string
+		want    result
+		wantErr bool
+	}{
+		{s: "22", want: result{remote: 22}},
+		{s: "8080:22", want: result{local: 8080, remote: 22}},
+		{s: "db:5432", want: result{target: "db", remote: 5432}},
+		{s: "8080:192.168.1.1:80", want: result{local: 8080, target: "192.168.1.1", remote: 80}},
+		{s: "8080:localhost:80", want: result{local: 8080, remote: 80}},
+		{s: "0.0.0.0:8080:192.168.1.1:80", want: result{"0.0.0.0", 8080, "192.168.1.1", 80}},
+		{s: "*:8080::80", want: result{bind: "*", local: 8080, remote: 80}},
+		{s: ":8080::80", want: result{bind: "*", local: 8080, remote: 80}},
+		{s: "0.0.0.0:8080:80", want: result{bind: "0.0.0.0", local: 8080, remote: 80}},
+		{s: "*:8080:80", want: result{bind: "*", local: 8080, remote: 80}},
+		{s: ":8080:80", want: result{bind: "*", local: 8080, remote: 80}},
+		{s: "[::1]:8080:22", want: result{bind: "::1", local: 8080, remote: 22}},
+		{s: "8080:[::1]:22", want: result{local: 8080, remote: 22}},
+		{s: "[::1]:8080:[fe80::1]:80", want: result{"::1", 8080, "fe80::1", 80}},
+		{s: "", wantErr: true},
+		{s: "abc:xyz", wantErr: true},
+		{s: "8080:0", wantErr: true},
+		{s: "8080:65536", wantErr: true},
+		{s: "70000:22", wantErr: true},
+		{s: "web:db:22", wantErr: true},
+		{s: "a:web:db:22", wantErr: true},
+		{s: "1:2:3:4:5", wantErr: true},
+	}
+	for _, tt := range tests {
+		bind, local, target, remote, err := parseBindAddress(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBindAddress(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got := (result{bind, local, target, remote}); !tt.wantErr && got != tt.want {
+			t.Errorf("parseBindAddress(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    meshctl.Forward
+		wantErr bool
+	}{
+		{spec: "8080:22", want: meshctl.Forward{LocalPort: 8080, RemotePort: 22}},
+		{spec: "web01=8080:22", want: meshctl.Forward{NodeID: "web01", LocalPort: 8080, RemotePort: 22}},
+		{spec: "node//a=b=8080:22", want: meshctl.Forward{NodeID: "node//a=b", LocalPort: 8080, RemotePort: 22}},
+		{spec: "web01=[::1]:8080:22", want: meshctl.Forward{NodeID: "web01", BindAddress: "::1", LocalPort: 8080, RemotePort: 22}},
+		{spec: "/run/db.sock:5432", want: meshctl.Forward{LocalPath: "/run/db.sock", RemotePort: 5432}},
+		{spec: "./db.sock:db:5432", want: meshctl.Forward{LocalPath: "./db.sock", Target: "db", RemotePort: 5432}},
+		{spec: "=8080:22", wantErr: true},
+		{spec: "/run/db.sock", wantErr: true},
+		{spec: "/run/db.sock:8080:22", wantErr: true},
+		{spec: "abc:xyz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseForward(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseForward(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseForward(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
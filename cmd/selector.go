@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// Connection state bits of a device, as reported in its conn field
+const (
+	connAgent    = 1
+	connAMTCIRA  = 2
+	connAMTLocal = 4
+	connRelay    = 8
+)
+
+// connFlags maps the values of --conn to connection state bits.
+var connFlags = map[string]int{
+	"agent": connAgent,
+	"amt":   connAMTCIRA | connAMTLocal,
+	"relay": connRelay,
+}
+
+// deviceSorts lists the values of --sort.
+var deviceSorts = []string{"name", "ip", "os", "lastseen"}
+
+// deviceSelector chooses and orders devices from a device list. The zero
+// value keeps the online devices, sorted by hostname.
+type deviceSelector struct {
+	all    bool
+	groups []string
+	tags   []string
+	os     string
+	name   *regexp.Regexp
+	ips    []netip.Prefix
+	conn   int
+	sort   string
+}
+
+// addSelectorFlags adds the flags parsed by getSelector to cmd.
+func addSelectorFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("all", false, "Include offline devices")
+	cmd.Flags().StringArray("group", nil, "Only devices in this device group (name or ID), repeatable")
+	cmd.Flags().StringArray("tag", nil, "Only devices with this tag, repeatable: all must match")
+	cmd.Flags().String("os", "", "Only devices whose OS contains this text")
+	cmd.Flags().String("name", "", "Only devices whose name or hostname matches this glob, or regular expression between slashes: /^web[0-9]+$/")
+	cmd.Flags().StringArray("ip", nil, "Only devices with an IP in this CIDR range or address, repeatable")
+	cmd.Flags().StringSlice("conn", nil, "Only devices connected through agent, amt or relay")
+	cmd.Flags().String("sort", "name", "Sort by "+strings.Join(deviceSorts, ", "))
+	cmd.Flags().String("select", "", "Selector expression of the flags above, e.g. 'group=Office,tag=prod,name=web*,all'")
+}
+
+// getSelector returns the selector given with the flags of addSelectorFlags.
+func getSelector(cmd *cobra.Command) deviceSelector {
+	s, err := parseSelector(cmd)
+	if err != nil {
+		pExit("Invalid device selector:", usageError{err})
+	}
+	return s
+}
+
+// parseSelector parses the selector flags, then the terms of --select on
+// top of them, as if they were given as flags after the others.
+func parseSelector(cmd *cobra.Command) (deviceSelector, error) {
+	var terms []selectorTerm
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		terms = append(terms, selectorTerm{"all", ""})
+	}
+	for _, key := range []string{"group", "tag", "ip"} {
+		values, _ := cmd.Flags().GetStringArray(key)
+		for _, value := range values {
+			terms = append(terms, selectorTerm{key, value})
+		}
+	}
+	for _, key := range []string{"os", "name", "sort"} {
+		if value, _ := cmd.Flags().GetString(key); value != "" {
+			terms = append(terms, selectorTerm{key, value})
+		}
+	}
+	conns, _ := cmd.Flags().GetStringSlice("conn")
+	for _, conn := range conns {
+		terms = append(terms, selectorTerm{"conn", conn})
+	}
+
+	expression, _ := cmd.Flags().GetString("select")
+	exprTerms, err := parseSelectorExpression(expression)
+	if err != nil {
+		return deviceSelector{}, err
+	}
+	return newDeviceSelector(append(terms, exprTerms...))
+}
+
+// selectorTerm is one key and value of a selector, as given by a flag or
+// a term of a selector expression.
+type selectorTerm struct {
+	key   string
+	value string
+}
+
+// parseSelectorExpression splits a selector expression into its terms. The
+// terms are separated by commas and written key=value, with the keys and
+// values of the selector flags; "all" needs no value. Commas inside a
+// regular expression between slashes, as in name=/^web{1,2}$/, do not
+// separate terms.
+func parseSelectorExpression(expression string) ([]selectorTerm, error) {
+	var terms []selectorTerm
+	parts := strings.Split(expression, ",")
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if strings.HasPrefix(value, "/") {
+			for (len(value) < 2 || !strings.HasSuffix(value, "/")) && i+1 < len(parts) {
+				i++
+				value += "," + strings.TrimRight(parts[i], " ")
+			}
+		}
+		if value == "" && key != "all" {
+			return nil, fmt.Errorf("selector term %q needs a value, as in %s=...", part, key)
+		}
+		terms = append(terms, selectorTerm{key, value})
+	}
+	return terms, nil
+}
+
+// newDeviceSelector returns the selector made of terms, in order: later
+// values of os, name and sort replace earlier ones, the others add up.
+func newDeviceSelector(terms []selectorTerm) (deviceSelector, error) {
+	s := deviceSelector{sort: "name"}
+	for _, t := range terms {
+		switch t.key {
+		case "all":
+			all, err := strconv.ParseBool(cmp.Or(t.value, "true"))
+			if err != nil {
+				return s, fmt.Errorf("invalid all=%s, use true or false", t.value)
+			}
+			s.all = all
+		case "group":
+			s.groups = append(s.groups, t.value)
+		case "tag":
+			s.tags = append(s.tags, t.value)
+		case "os":
+			s.os = t.value
+		case "name":
+			name, err := parseNamePattern(t.value)
+			if err != nil {
+				return s, err
+			}
+			s.name = name
+		case "ip":
+			prefix, err := parsePrefix(t.value)
+			if err != nil {
+				return s, err
+			}
+			s.ips = append(s.ips, prefix)
+		case "conn":
+			bits, ok := connFlags[strings.ToLower(t.value)]
+			if !ok {
+				return s, fmt.Errorf("unknown connection %q, use agent, amt or relay", t.value)
+			}
+			s.conn |= bits
+		case "sort":
+			if !slices.Contains(deviceSorts, t.value) {
+				return s, fmt.Errorf("unknown sort %q, use %s", t.value, strings.Join(deviceSorts, ", "))
+			}
+			s.sort = t.value
+		default:
+			return s, fmt.Errorf("unknown selector term %q, use all, group, tag, os, name, ip, conn or sort", t.key)
+		}
+	}
+	return s, nil
+}
+
+// parseNamePattern compiles a glob, or a regular expression between
+// slashes, into a case-insensitive regular expression.
+func parseNamePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+		return re, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid name glob %q: %w", pattern, err)
+	}
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// parsePrefix parses a CIDR range, or a single address as a range of one.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return prefix, fmt.Errorf("invalid IP range %q", s)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// narrowed reports whether anything besides --all and --sort was given.
+func (s deviceSelector) narrowed() bool {
+	return len(s.groups) > 0 || len(s.tags) > 0 || s.os != "" || s.name != nil || len(s.ips) > 0 || s.conn != 0
+}
+
+// apply returns the selected devices in the selected order.
+func (s deviceSelector) apply(devices []meshctl.Device) []meshctl.Device {
+	var selected []meshctl.Device
+	for _, device := range devices {
+		if s.matches(device) {
+			selected = append(selected, device)
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		switch s.sort {
+		case "ip":
+			if addrA, addrB := deviceAddr(a), deviceAddr(b); addrA != addrB {
+				return addrA.Less(addrB)
+			}
+		case "os":
+			if a.OS != b.OS {
+				return a.OS < b.OS
+			}
+		case "lastseen":
+			// Most recently seen first
+			if !a.LastConnect.Equal(b.LastConnect) {
+				return a.LastConnect.After(b.LastConnect)
+			}
+		}
+		return a.Name < b.Name
+	})
+	return selected
+}
+
+// matches reports whether the device passes every filter.
+func (s deviceSelector) matches(device meshctl.Device) bool {
+	if !s.all && device.Pwr == 0 {
+		return false
+	}
+	if len(s.groups) > 0 && !containsFold(s.groups, device.MeshName) && !containsFold(s.groups, device.MeshID) {
+		return false
+	}
+	for _, tag := range s.tags {
+		if !containsFold(device.Tags, tag) {
+			return false
+		}
+	}
+	if s.os != "" && !strings.Contains(strings.ToLower(device.OS), strings.ToLower(s.os)) {
+		return false
+	}
+	if s.name != nil && !s.name.MatchString(device.Name) && !s.name.MatchString(device.DisplayName) {
+		return false
+	}
+	if len(s.ips) > 0 {
+		addr := deviceAddr(device)
+		inRange := false
+		for _, prefix := range s.ips {
+			if addr.IsValid() && prefix.Contains(addr) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false
+		}
+	}
+	if s.conn != 0 && device.Conn&s.conn == 0 {
+		return false
+	}
+	return true
+}
+
+// deviceAddr parses the IP of a device, which may carry a port. It is
+// invalid if the device has none.
+func deviceAddr(device meshctl.Device) netip.Addr {
+	ip := device.IP
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	addr, _ := netip.ParseAddr(ip)
+	return addr.Unmap()
+}
+
+// errNoDevice is returned when the selector leaves no device to pick.
+var errNoDevice = errors.New("no device matches")
+
+// pickDevice lets the user pick one of the devices chosen by the selector
+// flags of cmd. If the selector narrowed the list to a single device, it
+// is picked without asking.
+func pickDevice(cmd *cobra.Command, devices []meshctl.Device) string {
+	s := getSelector(cmd)
+	devices = s.apply(devices)
+	if len(devices) == 0 {
+		pExit("No device found:", errNoDevice)
+	}
+	if len(devices) == 1 && s.narrowed() {
+		return devices[0].Id
+	}
+	return searchDevices(&devices)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func TestParseSelectorExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []selectorTerm
+		wantErr    bool
+	}{
+		{expression: "", want: nil},
+		{expression: "all", want: []selectorTerm{{"all", ""}}},
+		{
+			expression: "group=Office, tag=prod,os=linux,ip=10.0.0.0/8,conn=agent,sort=lastseen,all",
+			want: []selectorTerm{
+				{"group", "Office"}, {"tag", "prod"}, {"os", "linux"}, {"ip", "10.0.0.0/8"},
+				{"conn", "agent"}, {"sort", "lastseen"}, {"all", ""},
+			},
+		},
+		{expression: "Name=web*", want: []selectorTerm{{"name", "web*"}}},
+		{expression: "name=/^web{1,2}[0-9]$/,tag=prod", want: []selectorTerm{{"name", "/^web{1,2}[0-9]$/"}, {"tag", "prod"}}},
+		{expression: "name=/a,b,c/", want: []selectorTerm{{"name", "/a,b,c/"}}},
+		{expression: "group=Office,,", want: []selectorTerm{{"group", "Office"}}},
+		{expression: "group=", wantErr: true},
+		{expression: "tag", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelectorExpression(tt.expression)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelectorExpression(%q) error = %v, want error %v", tt.expression, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSelectorExpression(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceSelector(t *testing.T) {
+	devices := []meshctl.Device{
+		{Id: "node//1", Name: "web01", OS: "Ubuntu Linux", IP: "10.0.0.5", Pwr: 1, Conn: connAgent, MeshName: "Office", Tags: []string{"prod"}},
+		{Id: "node//2", Name: "web02", OS: "Windows 11", IP: "10.0.0.6", Pwr: 1, Conn: connAgent, MeshName: "Office"},
+		{Id: "node//3", Name: "db01", OS: "Debian Linux", IP: "192.168.1.10", Pwr: 0, MeshName: "Lab", Tags: []string{"prod"}},
+		{Id: "node//4", Name: "web11", OS: "Ubuntu Linux", IP: "[::1]:22", Pwr: 1, Conn: connRelay, MeshName: "Lab"},
+	}
+	tests := []struct {
+		expression string
+		want       []string
+		wantErr    bool
+	}{
+		{expression: "", want: []string{"node//1", "node//2", "node//4"}},
+		{expression: "all", want: []string{"node//3", "node//1", "node//2", "node//4"}},
+		{expression: "all=false,group=lab", want: []string{"node//4"}},
+		{expression: "all,tag=prod,os=linux", want: []string{"node//3", "node//1"}},
+		{expression: "name=web0*", want: []string{"node//1", "node//2"}},
+		{expression: "name=/^web[0-9]{1,2}$/,conn=relay", want: []string{"node//4"}},
+		{expression: "all,ip=10.0.0.0/8,ip=::1,sort=ip", want: []string{"node//1", "node//2", "node//4"}},
+		{expression: "group=Office,group=Lab,sort=os", want: []string{"node//1", "node//4", "node//2"}},
+		{expression: "colour=red", wantErr: true},
+		{expression: "conn=bluetooth", wantErr: true},
+		{expression: "sort=size", wantErr: true},
+		{expression: "ip=10.0.0.0/33", wantErr: true},
+		{expression: "name=/[/", wantErr: true},
+		{expression: "all=maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		terms, err := parseSelectorExpression(tt.expression)
+		if err != nil {
+			t.Fatalf("parseSelectorExpression(%q): %v", tt.expression, err)
+		}
+		s, err := newDeviceSelector(terms)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, want error %v", tt.expression, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		var got []string
+		for _, d := range s.apply(devices) {
+			got = append(got, d.Id)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q selected %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package cmd
 
 import (
-	"github.com/lexpaval/mesh-central-client-go/internal/meshcentral"
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
@@ -12,46 +13,38 @@ var shellCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		nodeID, _ := cmd.Flags().GetString("nodeid")
-		debug, _ := cmd.Flags().GetBool("debug")
 		powershell, _ := cmd.Flags().GetBool("powershell")
-		insecure, _ := cmd.Flags().GetBool("insecure")
 
-		meshcentral.ApplySettings(
-			nodeID,
-			0,
-			0,
-			"",
-			insecure,
-			debug,
-		)
+		// open shell
+		protocol := 1
+		if powershell {
+			protocol = 6
+		}
 
-		meshcentral.StartSocket()
+		if path := daemonSocket(cmd); path != "" {
+			if nodeID == "" {
+				nodeID = daemonSelectDevice(cmd, path)
+			}
+			pExit("Shell failed:", shellControl(path, nodeID, protocol, os.Stdin, os.Stdout))
+			return
+		}
 
-		if nodeID == "" {
-			devices := meshcentral.GetDevices()
-			filterAndSortDevices(&devices)
-			nodeID = searchDevices(&devices)
+		ctx := cmd.Context()
+		client := newClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
 
-			meshcentral.ApplySettings(
-				nodeID,
-				0,
-				0,
-				"",
-				insecure,
-				debug,
-			)
+		if nodeID == "" {
+			nodeID = selectDevice(cmd, client)
+		} else {
+			var err error
+			nodeID, err = newNodeResolver(client, cacheTTL(cmd)).resolveNode(ctx, nodeID)
+			pExit("Failed to resolve node:", err)
 		}
 
 		//ready := make(chan struct{})
 
-		// open shell
-		protocol := 1
-		if powershell {
-			protocol = 6
-		}
-		meshcentral.StartShell(protocol)
-
-		meshcentral.StopSocket()
+		pExit("Shell failed:", interrupted(client.Shell(ctx, nodeID, protocol)))
 
 	},
 }
@@ -59,8 +52,10 @@ var shellCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(shellCmd)
 
-	shellCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID")
+	shellCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID, device name, hostname, IP or alias")
 	shellCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
 	shellCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
 	shellCmd.Flags().BoolP("powershell", "p", false, "Use powershell instead of cmd.exe (windows agents only")
+	addSelectorFlags(shellCmd)
+	addNodeCompletion(shellCmd)
 }
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+var socksCmd = &cobra.Command{
+	Use:   "socks",
+	Short: "Run a local SOCKS5 proxy into the network of a node",
+	Long: `Runs a SOCKS5 proxy on a local port. Every connection made through it is
+relayed by the node to the requested address, like ssh -D.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		nodeID, _ := cmd.Flags().GetString("nodeid")
+		dynamic, _ := cmd.Flags().GetString("dynamic")
+		httpConnect, _ := cmd.Flags().GetBool("http")
+		gatewayPorts, _ := cmd.Flags().GetBool("gateway-ports")
+
+		bindAddress, localport, err := parseDynamicAddress(dynamic)
+		if err != nil {
+			pExit("Error parsing proxy address:", usageError{err})
+		}
+		if bindAddress == "" && gatewayPorts {
+			bindAddress = "*"
+		}
+
+		ctx := cmd.Context()
+		client := newForwardingClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
+
+		if nodeID == "" {
+			nodeID = selectDevice(cmd, client)
+		} else {
+			resolver := newNodeResolver(client, cacheTTL(cmd))
+			nodeID, err = resolver.resolveNode(ctx, nodeID)
+			pExit("Failed to resolve node:", err)
+		}
+
+		ready := make(chan int, 1)
+		socksErr := make(chan error, 1)
+		go func() {
+			socksErr <- client.Socks(ctx, meshctl.DynamicForward{
+				NodeID:      nodeID,
+				BindAddress: bindAddress,
+				LocalPort:   localport,
+				HTTP:        httpConnect,
+			}, ready)
+		}()
+		select {
+		case <-ready:
+		case err := <-socksErr:
+			pExit("Proxy failed:", interrupted(err))
+			return
+		}
+		for _, stats := range client.Stats() {
+			if !stats.Socks {
+				continue
+			}
+			if httpConnect {
+				fmt.Printf("SOCKS5 and HTTP proxy listening on %s.\n", stats.LocalAddr)
+			} else {
+				fmt.Printf("SOCKS5 proxy listening on %s.\n", stats.LocalAddr)
+			}
+		}
+
+		stopStats := watchStats(cmd, client)
+		err = <-socksErr
+		stopStats()
+		pExit("Proxy failed:", interrupted(err))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(socksCmd)
+
+	socksCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID, device name, hostname, IP or alias")
+	socksCmd.Flags().StringP("dynamic", "D", "1080", "[bindaddr:]port of the proxy")
+	socksCmd.Flags().BoolP("gateway-ports", "g", false, "Allow other hosts to connect when no bind address is given")
+	socksCmd.Flags().BoolP("http", "", false, "Also accept HTTP CONNECT requests on the same port")
+	addStatsFlags(socksCmd)
+	addSelectorFlags(socksCmd)
+	addNodeCompletion(socksCmd)
+	socksCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
+	socksCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
+}
+
+// parseDynamicAddress parses a -D address: "[bindaddr:]port", with IPv6
+// addresses in brackets. An empty bind address (":1080") means all
+// interfaces.
+func parseDynamicAddress(s string) (bindAddress string, port int, err error) {
+	parts, err := splitHostPorts(s)
+	if err != nil {
+		return "", 0, err
+	}
+	switch len(parts) {
+	case 1:
+	case 2:
+		bindAddress = parts[0]
+		if bindAddress == "" {
+			bindAddress = "*"
+		}
+	default:
+		return "", 0, errors.New("invalid proxy address format")
+	}
+
+	if !isDigits(parts[len(parts)-1]) {
+		return "", 0, errors.New("invalid proxy address format")
+	}
+	port, err = strconv.Atoi(parts[len(parts)-1])
+	if err != nil || port > 65535 {
+		return "", 0, errors.New("invalid proxy address format")
+	}
+	return bindAddress, port, nil
+}
@@ -1,20 +1,27 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 
-	"github.com/lexpaval/mesh-central-client-go/internal/meshcentral"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
 )
 
 var sshCmd = &cobra.Command{
 	Use:   "ssh [user][@target]",
 	Short: "Shortcut to ssh into a node",
-	Long:  `Opens SSH connection with the OpenSSH Client to a node via the local proxy`,
+	Long: `Opens SSH connection with the OpenSSH Client to a node via the local proxy.
+Without -i, target is the node: a device name, hostname, IP or alias, as in
+mcc ssh root@web01. If no device matches, target is a host to reach through
+a node picked from a list. With -i, target is a host the node connects to.`,
+	ValidArgsFunction: completeSSHTarget,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		user := "root"
@@ -32,77 +39,128 @@ var sshCmd = &cobra.Command{
 		remoteport, _ := cmd.Flags().GetInt("port")
 
 		nodeID, _ := cmd.Flags().GetString("nodeid")
-		debug, _ := cmd.Flags().GetBool("debug")
 		proxyMode, _ := cmd.Flags().GetBool("proxy")
-		insecure, _ := cmd.Flags().GetBool("insecure")
+
+		// Without -i, the target names the node itself
+		host := target
+		targetIsNode := nodeID == "" && target != ""
+		if targetIsNode {
+			nodeID = target
+			target = ""
+		}
 
 		// generate random local port num
 		localport := 0
 
-		meshcentral.ApplySettings(
-			nodeID,
-			remoteport,
-			localport,
-			target,
-			insecure,
-			debug,
-		)
+		ctx := cmd.Context()
+		if path := daemonSocket(cmd); path != "" {
+			if nodeID == "" {
+				nodeID = daemonSelectDevice(cmd, path)
+			} else if targetIsNode {
+				nodeID, target = resolveSSHTarget(ctx, daemonResolver(path), host, func() string {
+					return daemonSelectDevice(cmd, path)
+				})
+			}
+			request := controlRequest{Action: "dial", Node: nodeID, Target: target, Port: remoteport}
+			if proxyMode {
+				pExit("Proxy failed:", proxyControl(path, request, os.Stdin, os.Stdout))
+				return
+			}
+			sshPort, err := listenControl(ctx, path, request)
+			pExit("Failed to forward:", err)
+			runSSH(user, host, remoteport, sshPort)
+			return
+		}
 
-		meshcentral.StartSocket()
+		client := newClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
 
+		resolver := newNodeResolver(client, cacheTTL(cmd))
 		if nodeID == "" {
-			devices := meshcentral.GetDevices()
-			filterAndSortDevices(&devices)
-			nodeID = searchDevices(&devices)
-
-			meshcentral.ApplySettings(
-				nodeID,
-				remoteport,
-				localport,
-				target,
-				insecure,
-				debug,
-			)
+			nodeID = selectDevice(cmd, client)
+		} else if targetIsNode {
+			nodeID, target = resolveSSHTarget(ctx, resolver, host, func() string {
+				return selectDevice(cmd, client)
+			})
+		} else {
+			var err error
+			nodeID, err = resolver.resolveNode(ctx, nodeID)
+			pExit("Failed to resolve node:", err)
 		}
 
-		ready := make(chan struct{})
+		forward := meshctl.Forward{
+			NodeID:     nodeID,
+			LocalPort:  localport,
+			Target:     target,
+			RemotePort: remoteport,
+		}
 
 		if proxyMode {
 			// Proxy mode: pipe stdin/stdout directly through WebSocket
-			go meshcentral.StartProxyRouter(ready)
-			<-ready
-			select {} // Keep running until connection dies
+			pExit("Proxy failed:", interrupted(client.Proxy(ctx, forward)))
 		} else {
 			// Interactive mode: start proxy and launch SSH client
-			go meshcentral.StartRouter(ready)
-			<-ready
-
-			// start ssh client
-			sshPort := meshcentral.GetLocalPort()
-			fmt.Printf("SSH into %s:%d via 127.0.0.1:%d\n", target, remoteport, sshPort)
-			sshCmd := exec.Command("ssh", "-o", "ServerAliveInterval=60",
-				"-o", "ServerAliveCountMax=3",
-				"-o", "StrictHostKeyChecking=no",
-				"-o", "UserKnownHostsFile=/dev/null",
-				fmt.Sprintf("-p%d", sshPort), fmt.Sprintf("%s@127.0.0.1", user),
-			)
-			sshCmd.Stdout = os.Stdout
-			sshCmd.Stderr = os.Stderr
-			sshCmd.Stdin = os.Stdin
-			err := sshCmd.Run()
-			if err != nil {
-				fmt.Printf("Unable to start SSH client: %v\n", err)
+			ready := make(chan int, 1)
+			routeErr := make(chan error, 1)
+			go func() {
+				routeErr <- client.Route(ctx, forward, ready)
+			}()
+			var sshPort int
+			select {
+			case sshPort = <-ready:
+			case err := <-routeErr:
+				pExit("Failed to forward:", interrupted(err))
+				return
+			case <-ctx.Done():
+				return
 			}
+
+			runSSH(user, host, remoteport, sshPort)
 		}
 	},
 }
 
+// resolveSSHTarget resolves the target of mcc ssh user@target as a node. A
+// target matching no device is a host reached through the node returned by
+// pick instead, as it was before devices could be named.
+func resolveSSHTarget(ctx context.Context, resolver *nodeResolver, host string, pick func() string) (nodeID string, target string) {
+	nodeID, err := resolver.resolveNode(ctx, host)
+	if errors.Is(err, errUnknownDevice) {
+		pterm.Info.WithWriter(os.Stderr).Printfln("No device %s, select the node to reach it through.", host)
+		return pick(), host
+	}
+	pExit("Failed to resolve node:", err)
+	return nodeID, ""
+}
+
+// runSSH runs the OpenSSH client against a forward on the local sshPort.
+// host is only shown.
+func runSSH(user string, host string, remoteport int, sshPort int) {
+	fmt.Printf("SSH into %s:%d via 127.0.0.1:%d\n", host, remoteport, sshPort)
+	sshCmd := exec.Command("ssh", "-o", "ServerAliveInterval=60",
+		"-o", "ServerAliveCountMax=3",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		fmt.Sprintf("-p%d", sshPort), fmt.Sprintf("%s@127.0.0.1", user),
+	)
+	sshCmd.Stdout = os.Stdout
+	sshCmd.Stderr = os.Stderr
+	sshCmd.Stdin = os.Stdin
+	err := sshCmd.Run()
+	if err != nil {
+		fmt.Printf("Unable to start SSH client: %v\n", err)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(sshCmd)
 
-	sshCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID")
+	sshCmd.Flags().StringP("nodeid", "i", "", "Mesh Central Node ID, device name, hostname, IP or alias")
 	sshCmd.Flags().IntP("port", "p", 22, "Define the remote ssh port")
 	sshCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
 	sshCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
 	sshCmd.Flags().BoolP("proxy", "", false, "Proxy mode for SSH ProxyCommand")
+	addSelectorFlags(sshCmd)
+	addNodeCompletion(sshCmd)
 }
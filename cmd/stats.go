@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// dashboardInterval is how often the live dashboard is redrawn
+const dashboardInterval = time.Second
+
+// addStatsFlags adds the flags read by watchStats to a forwarding command.
+func addStatsFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("stats", "", false, "Show a live dashboard of the traffic of each forward and the round trip time to the server")
+	cmd.Flags().BoolP("stats-json", "", false, "Print the traffic of each forward as a JSON line periodically")
+	cmd.Flags().Duration("stats-interval", 10*time.Second, "Interval of --stats-json output")
+}
+
+// forwardStatsJSON is a forward in the --stats-json output and the control
+// socket API.
+type forwardStatsJSON struct {
+	ID              string  `json:"id,omitempty"`
+	Node            string  `json:"node"`
+	Protocol        string  `json:"protocol"`
+	Local           string  `json:"local"`
+	Remote          string  `json:"remote,omitempty"`
+	Connections     int64   `json:"connections"`
+	Active          int64   `json:"active"`
+	BytesIn         int64   `json:"bytes_in"`
+	BytesOut        int64   `json:"bytes_out"`
+	UptimeSeconds   float64 `json:"uptime_seconds"`
+	ServerRTTMillis float64 `json:"server_rtt_ms,omitempty"`
+}
+
+func toStatsJSON(s meshctl.ForwardStats) forwardStatsJSON {
+	return forwardStatsJSON{
+		ID:              s.Forward.Name,
+		Node:            s.Forward.NodeID,
+		Protocol:        protocolOf(s),
+		Local:           s.LocalAddr,
+		Remote:          remoteOf(s),
+		Connections:     s.Connections,
+		Active:          s.Active,
+		BytesIn:         s.BytesIn,
+		BytesOut:        s.BytesOut,
+		UptimeSeconds:   time.Since(s.Started).Seconds(),
+		ServerRTTMillis: float64(s.ServerRTT) / float64(time.Millisecond),
+	}
+}
+
+// watchStats reports the client's forwards as selected by the flags added
+// with addStatsFlags, until the returned function is called.
+func watchStats(cmd *cobra.Command, client *meshctl.Client) (stop func()) {
+	dashboard, _ := cmd.Flags().GetBool("stats")
+	jsonOutput, _ := cmd.Flags().GetBool("stats-json")
+	interval, _ := cmd.Flags().GetDuration("stats-interval")
+	if !dashboard && !jsonOutput {
+		return func() {}
+	}
+	if dashboard || interval <= 0 {
+		interval = dashboardInterval
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	done := make(chan struct{})
+	go client.MeasureServerRTT(ctx)
+
+	var area *pterm.AreaPrinter
+	if dashboard {
+		area, _ = pterm.DefaultArea.Start()
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			stats := client.Stats()
+			if area != nil {
+				area.Update(renderStats(statsJSON(stats)))
+			} else {
+				printStatsJSON(stats)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if area != nil {
+			area.Stop()
+		}
+	}
+}
+
+// renderStats returns the dashboard table for forwards.
+func renderStats(forwards []forwardStatsJSON) string {
+	data := [][]string{{"ID", "Local", "Remote", "Node", "Conns", "In", "Out", "Up", "Server RTT"}}
+	for _, f := range forwards {
+		rtt := "-"
+		if f.ServerRTTMillis > 0 {
+			rtt = time.Duration(f.ServerRTTMillis * float64(time.Millisecond)).Round(time.Millisecond).String()
+		}
+		remote := f.Remote
+		if remote == "" {
+			remote = f.Protocol
+		} else if f.Protocol == "udp" {
+			remote += "/udp"
+		}
+		data = append(data, []string{
+			f.ID,
+			f.Local,
+			remote,
+			shortNodeID(f.Node),
+			fmt.Sprintf("%d/%d", f.Active, f.Connections),
+			formatBytes(f.BytesIn),
+			formatBytes(f.BytesOut),
+			(time.Duration(f.UptimeSeconds) * time.Second).String(),
+			rtt,
+		})
+	}
+	table, _ := pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(data).Srender()
+	return table
+}
+
+// statsJSON converts stats for output.
+func statsJSON(stats []meshctl.ForwardStats) []forwardStatsJSON {
+	forwards := make([]forwardStatsJSON, len(stats))
+	for i, s := range stats {
+		forwards[i] = toStatsJSON(s)
+	}
+	return forwards
+}
+
+// printStatsJSON prints stats as one JSON line.
+func printStatsJSON(stats []meshctl.ForwardStats) {
+	line, err := json.Marshal(struct {
+		Time     time.Time          `json:"time"`
+		Forwards []forwardStatsJSON `json:"forwards"`
+	}{time.Now(), statsJSON(stats)})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to encode stats:", err)
+		return
+	}
+	fmt.Println(string(line))
+}
+
+func protocolOf(s meshctl.ForwardStats) string {
+	switch {
+	case s.Socks:
+		return "socks"
+	case s.Forward.UDP:
+		return "udp"
+	}
+	return "tcp"
+}
+
+// remoteOf returns where the forward leads on the node's side.
+func remoteOf(s meshctl.ForwardStats) string {
+	if s.Socks {
+		return ""
+	}
+	target := s.Forward.Target
+	if target == "" {
+		target = "node"
+	}
+	return target + ":" + strconv.Itoa(s.Forward.RemotePort)
+}
+
+// shortNodeID trims a node ID for display.
+func shortNodeID(id string) string {
+	id = strings.TrimPrefix(id, "node//")
+	if len(id) > 12 {
+		return id[:12] + "…"
+	}
+	return id
+}
+
+// formatBytes returns n in human readable units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var tunnelsCmd = &cobra.Command{
+	Use:     "tunnels",
+	Aliases: []string{"t"},
+	Short:   "Manage the forwards of a running mcc route or mcc up",
+	Long: `Lists, adds and removes forwards of a running mcc route or mcc up of the
+active profile, reusing its authenticated session.`,
+}
+
+var tunnelsLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List the running forwards",
+	Run: func(cmd *cobra.Command, args []string) {
+		response := controlCall(cmd, controlRequest{Action: "ls"})
+		if len(response.Tunnels) == 0 {
+			pterm.Info.Println("No forwards running.")
+			return
+		}
+		fmt.Print(renderStats(response.Tunnels))
+	},
+}
+
+var tunnelsAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add forwards to the running session",
+	Run: func(cmd *cobra.Command, args []string) {
+		specs, _ := cmd.Flags().GetStringArray("bind-address")
+		udpSpecs, _ := cmd.Flags().GetStringArray("udp")
+		nodeID, _ := cmd.Flags().GetString("nodeid")
+		gatewayPorts, _ := cmd.Flags().GetBool("gateway-ports")
+
+		requests := tunnelRequests(specs, udpSpecs, nodeID, gatewayPorts)
+		if len(requests) == 0 {
+			pExit("Nothing to add:", usageError{errors.New("at least one -L or -U is required")})
+		}
+
+		path, err := controlSocketPath(cmd)
+		pExit("Control socket unavailable:", err)
+		addTunnels(path, requests)
+	},
+}
+
+var tunnelsRmCmd = &cobra.Command{
+	Use:     "rm <id>...",
+	Aliases: []string{"remove"},
+	Short:   "Remove forwards by ID",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, id := range args {
+			controlCall(cmd, controlRequest{Action: "rm", ID: id})
+			pterm.Success.Println("Removed tunnel", id)
+		}
+	},
+}
+
+// tunnelRequests returns the add requests for -L and -U specs.
+func tunnelRequests(specs []string, udpSpecs []string, nodeID string, gatewayPorts bool) []controlRequest {
+	var requests []controlRequest
+	for _, spec := range specs {
+		requests = append(requests, controlRequest{Spec: spec, Node: nodeID, GatewayPorts: gatewayPorts})
+	}
+	for _, spec := range udpSpecs {
+		requests = append(requests, controlRequest{Spec: spec, UDP: true, Node: nodeID, GatewayPorts: gatewayPorts})
+	}
+	return requests
+}
+
+// controlCall sends request to the control socket, exiting on failure.
+func controlCall(cmd *cobra.Command, request controlRequest) *controlResponse {
+	path, err := controlSocketPath(cmd)
+	pExit("Control socket unavailable:", err)
+	response, err := callControl(path, request)
+	pExit("Request failed:", err)
+	return response
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelsCmd)
+
+	tunnelsCmd.AddCommand(tunnelsLsCmd)
+	tunnelsCmd.AddCommand(tunnelsAddCmd)
+	tunnelsCmd.AddCommand(tunnelsRmCmd)
+
+	tunnelsAddCmd.Flags().StringP("nodeid", "i", "", "Node ID, device name, hostname, IP or alias for specs without one")
+	tunnelsAddCmd.Flags().StringArrayP("bind-address", "L", nil, "[node=][bindaddr:]localport|socketpath:[target:]remoteport, repeatable")
+	tunnelsAddCmd.Flags().StringArrayP("udp", "U", nil, "[node=][bindaddr:]localport:[target:]remoteport for UDP, repeatable")
+	tunnelsAddCmd.Flags().BoolP("gateway-ports", "g", false, "Allow other hosts to connect to forwards without a bind address")
+	addNodeCompletion(tunnelsAddCmd)
+}
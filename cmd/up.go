@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+
+	"github.com/lexpaval/mesh-central-client-go/internal/config"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+var upCmd = &cobra.Command{
+	Use:   "up [tunnelset]",
+	Short: "Bring up the tunnels defined in the active profile",
+	Long: `Brings up every tunnel of a tunnel set from the active profile and keeps
+them running until interrupted. Without a name, the set named "default"
+(or the only set) is used.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		p, err := config.GetDefaultProfile()
+		pExit("No active profile:", err)
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			for _, set := range p.TunnelSetNames() {
+				pterm.Println(set)
+			}
+			return
+		}
+
+		tunnels, err := p.TunnelSet(name)
+		pExit("Failed to load tunnels:", err)
+
+		ctx := cmd.Context()
+		client := newForwardingClient(cmd)
+		pExit("Failed to connect:", client.Connect(ctx))
+		defer client.Close()
+
+		resolver := newNodeResolver(client, cacheTTL(cmd))
+		forwards := make([]meshctl.Forward, len(tunnels))
+		for i, t := range tunnels {
+			nodeID, err := resolver.resolveNode(ctx, t.Node)
+			pExit(fmt.Sprintf("Tunnel %d:", i+1), err)
+
+			forwards[i] = meshctl.Forward{
+				NodeID:      nodeID,
+				BindAddress: t.BindAddress,
+				LocalPort:   t.LocalPort,
+				LocalPath:   t.LocalPath,
+				Target:      t.Target,
+				RemotePort:  t.RemotePort,
+				UDP:         t.UDP,
+			}
+		}
+		gatewayPorts, _ := cmd.Flags().GetBool("gateway-ports")
+		allowGatewayPorts(forwards, gatewayPorts)
+
+		runForwards(cmd, client, forwards)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upCmd)
+
+	upCmd.Flags().BoolP("list", "l", false, "List the tunnel sets of the active profile")
+	upCmd.Flags().BoolP("gateway-ports", "g", false, "Allow other hosts to connect to tunnels without a bind address")
+	addStatsFlags(upCmd)
+	upCmd.Flags().BoolP("insecure", "k", false, "Skip TLS certificate verification (insecure, for testing only)")
+	upCmd.Flags().BoolP("debug", "", false, "Enable debug logging")
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// AliasNames returns the names of the profile's device aliases, sorted.
+func (p *Profile) AliasNames() []string {
+	names := make([]string, 0, len(p.Aliases))
+	for name := range p.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Alias returns the node ID, device name, hostname or IP that the alias
+// name stands for. Names are case-insensitive.
+func (p *Profile) Alias(name string) (string, bool) {
+	// Viper lowercases map keys when reading the config
+	node, ok := p.Aliases[strings.ToLower(name)]
+	return node, ok && node != ""
+}
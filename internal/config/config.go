@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -35,17 +36,20 @@ func CreateConfig(server string, username string, password string) error {
 	path := filepath.Dir(viper.ConfigFileUsed())
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if err := os.MkdirAll(path, 0700); err != nil {
-			return err
+			return fmt.Errorf("unable to create config directory: %w", err)
 		}
 	}
 
 	// Write config first
-	if err := viper.WriteConfig(); err != nil {
+	if err := writeConfig(); err != nil {
 		return err
 	}
 
 	// Store password in keyring
-	return keyring.Set(keyringService, "default", password)
+	if err := keyring.Set(keyringService, "default", password); err != nil {
+		return fmt.Errorf("%w: %v", ErrKeyring, err)
+	}
+	return nil
 }
 
 func LoadConfig() error {
@@ -65,7 +69,30 @@ func LoadConfig() error {
 		},
 	})
 
-	return viper.ReadInConfig()
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("unable to read config: %w", err)
+	}
+	return nil
+}
+
+// ControlSocketPath returns the path of the control socket of a running
+// mcc process for the given profile, creating its directory if necessary.
+func ControlSocketPath(profile string) (string, error) {
+	dir := filepath.Join(xdg.RuntimeDir, "mcc")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create runtime directory: %w", err)
+	}
+	return filepath.Join(dir, profile+".sock"), nil
+}
+
+// DeviceCachePath returns the path of the device cache of the given
+// profile, creating its directory if necessary.
+func DeviceCachePath(profile string) (string, error) {
+	dir := filepath.Join(xdg.CacheHome, "mcc")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create cache directory: %w", err)
+	}
+	return filepath.Join(dir, profile+".devices.json"), nil
 }
 
 func GetConfigPath() string {
@@ -82,5 +109,5 @@ func GetConfigJSON() (*string, error) {
 }
 
 func SaveConfig() error {
-	return viper.WriteConfig()
+	return writeConfig()
 }
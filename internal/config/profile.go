@@ -1,6 +1,9 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/spf13/viper"
 	"github.com/zalando/go-keyring"
 )
@@ -11,6 +14,13 @@ type Profile struct {
 	Server   string
 	Username string
 	Password string `json:"-"` // Don't serialize password
+
+	// Tunnels holds the named tunnel sets brought up by mcc up
+	Tunnels map[string][]Tunnel `json:",omitempty"`
+
+	// Aliases maps short names to the devices they stand for wherever a
+	// node is given
+	Aliases map[string]string `json:",omitempty"`
 }
 
 // GetPassword retrieves password from system keyring
@@ -28,9 +38,28 @@ func (p *Profile) DeletePassword() error {
 	return keyring.Delete(keyringService, p.Name)
 }
 
-func GetProfiles() []Profile {
+// readProfiles returns the profiles from the config, without passwords.
+func readProfiles() ([]Profile, error) {
 	var profiles []Profile
-	viper.UnmarshalKey("profiles", &profiles)
+	if err := viper.UnmarshalKey("profiles", &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles in config: %w", err)
+	}
+	return profiles, nil
+}
+
+// writeConfig saves the config file.
+func writeConfig() error {
+	if err := viper.WriteConfig(); err != nil {
+		return fmt.Errorf("unable to write config: %w", err)
+	}
+	return nil
+}
+
+func GetProfiles() ([]Profile, error) {
+	profiles, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
 
 	// Load passwords from keyring
 	for i := range profiles {
@@ -39,12 +68,14 @@ func GetProfiles() []Profile {
 		}
 	}
 
-	return profiles
+	return profiles, nil
 }
 
-func GetDefaultProfile() Profile {
-	var profiles []Profile
-	viper.UnmarshalKey("profiles", &profiles)
+func GetDefaultProfile() (Profile, error) {
+	profiles, err := readProfiles()
+	if err != nil {
+		return Profile{}, err
+	}
 
 	defaultProfile := viper.GetString("default_profile")
 
@@ -54,11 +85,11 @@ func GetDefaultProfile() Profile {
 			if pwd, err := p.GetPassword(); err == nil {
 				p.Password = pwd
 			}
-			return p
+			return p, nil
 		}
 	}
 
-	return Profile{}
+	return Profile{}, &ProfileNotFoundError{defaultProfile}
 }
 
 func GetDefaultProfileName() string {
@@ -67,15 +98,17 @@ func GetDefaultProfileName() string {
 
 func SetDefaultProfile(name string, commit bool) error {
 	// get profiles from config
-	var profiles []Profile
-	viper.UnmarshalKey("profiles", &profiles)
+	profiles, err := readProfiles()
+	if err != nil {
+		return err
+	}
 
 	// make sure profile exists
 	for _, p := range profiles {
 		if p.Name == name {
 			viper.Set("default_profile", name)
 			if commit {
-				viper.WriteConfig()
+				return writeConfig()
 			}
 			return nil
 		}
@@ -83,9 +116,11 @@ func SetDefaultProfile(name string, commit bool) error {
 	return &ProfileNotFoundError{name}
 }
 
-func AddProfile(name string, isDefault bool, server string, username string, password string) *Profile {
-	var profiles []Profile
-	viper.UnmarshalKey("profiles", &profiles)
+func AddProfile(name string, isDefault bool, server string, username string, password string) (*Profile, error) {
+	profiles, err := readProfiles()
+	if err != nil {
+		return nil, err
+	}
 
 	newProfile := Profile{
 		Name:     name,
@@ -95,8 +130,7 @@ func AddProfile(name string, isDefault bool, server string, username string, pas
 
 	// Store password in keyring
 	if err := newProfile.SetPassword(password); err != nil {
-		// Handle error - could log or return error instead
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrKeyring, err)
 	}
 
 	profiles = append(profiles, newProfile)
@@ -106,29 +140,43 @@ func AddProfile(name string, isDefault bool, server string, username string, pas
 	}
 
 	viper.Set("profiles", profiles)
-	viper.WriteConfig()
+	if err := writeConfig(); err != nil {
+		return nil, err
+	}
 
 	newProfile.Password = password // Set for return value
-	return &newProfile
+	return &newProfile, nil
 }
 
-func RemoveProfile(name string) {
-	var profiles []Profile
-	viper.UnmarshalKey("profiles", &profiles)
+func RemoveProfile(name string) error {
+	profiles, err := readProfiles()
+	if err != nil {
+		return err
+	}
 
+	found := false
 	for i, p := range profiles {
 		if p.Name == name {
-			// Delete password from keyring
-			p.DeletePassword()
+			// Delete password from keyring, it may never have been stored
+			if err := p.DeletePassword(); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+				return fmt.Errorf("%w: %v", ErrKeyring, err)
+			}
 			profiles = append(profiles[:i], profiles[i+1:]...)
+			found = true
 			break
 		}
 	}
+	if !found {
+		return &ProfileNotFoundError{name}
+	}
 
 	viper.Set("profiles", profiles)
-	viper.WriteConfig()
+	return writeConfig()
 }
 
+// ErrKeyring is returned when the system keyring cannot be used.
+var ErrKeyring = errors.New("keyring error")
+
 // profile not found error definition
 type ProfileNotFoundError struct {
 	Name string
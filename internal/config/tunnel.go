@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultTunnelSet is the tunnel set brought up when none is named.
+const DefaultTunnelSet = "default"
+
+// ErrTunnelSetNotFound is returned when a profile has no tunnel set of the
+// requested name.
+var ErrTunnelSetNotFound = errors.New("tunnel set not found")
+
+// Tunnel is a port forward declared in a profile. Node is a node ID or a
+// device name. BindAddress defaults to the loopback interface, "*" means
+// all interfaces. LocalPath, if set, is a unix socket used instead of the
+// local port. UDP forwards datagrams instead of a TCP stream.
+type Tunnel struct {
+	Node        string `json:"node"`
+	BindAddress string `json:"bindaddress,omitempty"`
+	LocalPort   int    `json:"localport"`
+	LocalPath   string `json:"localpath,omitempty"`
+	Target      string `json:"target,omitempty"`
+	RemotePort  int    `json:"remoteport"`
+	UDP         bool   `json:"udp,omitempty"`
+}
+
+// TunnelSetNames returns the names of the profile's tunnel sets, sorted.
+func (p *Profile) TunnelSetNames() []string {
+	names := make([]string, 0, len(p.Tunnels))
+	for name := range p.Tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TunnelSet returns the tunnels of the named set. An empty name selects
+// the set named "default", or the only set if there is just one. Names are
+// case-insensitive.
+func (p *Profile) TunnelSet(name string) ([]Tunnel, error) {
+	if name == "" {
+		if len(p.Tunnels) == 1 {
+			for _, tunnels := range p.Tunnels {
+				return tunnels, nil
+			}
+		}
+		name = DefaultTunnelSet
+	}
+
+	// Viper lowercases map keys when reading the config
+	tunnels, ok := p.Tunnels[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q in profile %s", ErrTunnelSetNotFound, name, p.Name)
+	}
+	if len(tunnels) == 0 {
+		return nil, fmt.Errorf("tunnel set %q in profile %s is empty", name, p.Name)
+	}
+	return tunnels, nil
+}
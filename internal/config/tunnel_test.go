@@ -0,0 +1,172 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+const testConfig = `{
+  "default_profile": "home",
+  "profiles": [
+    {
+      "name": "home",
+      "server": "mesh.example.com",
+      "username": "admin",
+      "tunnels": {
+        "Office": [
+          {"node": "web01", "localport": 8080, "remoteport": 80},
+          {"node": "node//db", "bindaddress": "*", "localport": 5432, "target": "10.0.0.6", "remoteport": 5432},
+          {"node": "web01", "localpath": "/tmp/ssh.sock", "remoteport": 22},
+          {"node": "web01", "localport": 1161, "remoteport": 161, "udp": true}
+        ],
+        "empty": []
+      }
+    }
+  ]
+}`
+
+var officeTunnels = []Tunnel{
+	{Node: "web01", LocalPort: 8080, RemotePort: 80},
+	{Node: "node//db", BindAddress: "*", LocalPort: 5432, Target: "10.0.0.6", RemotePort: 5432},
+	{Node: "web01", LocalPath: "/tmp/ssh.sock", RemotePort: 22},
+	{Node: "web01", LocalPort: 1161, RemotePort: 161, UDP: true},
+}
+
+// loadTestConfig writes testConfig to a temporary file and loads it, with
+// passwords kept in memory, until the test ends.
+func loadTestConfig(t *testing.T) string {
+	t.Helper()
+	keyring.MockInit()
+	t.Cleanup(viper.Reset)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(t, path)
+	return path
+}
+
+// reloadConfig reads the config file at path from scratch.
+func reloadConfig(t *testing.T, path string) {
+	t.Helper()
+	viper.Reset()
+	viper.SetConfigFile(path)
+	if err := LoadConfig(); err != nil {
+		t.Fatal("LoadConfig:", err)
+	}
+}
+
+// homeTunnels returns the tunnel sets of the home profile.
+func homeTunnels(t *testing.T) map[string][]Tunnel {
+	t.Helper()
+	profiles, err := GetProfiles()
+	if err != nil {
+		t.Fatal("GetProfiles:", err)
+	}
+	for _, p := range profiles {
+		if p.Name == "home" {
+			return p.Tunnels
+		}
+	}
+	t.Fatal("no home profile")
+	return nil
+}
+
+func TestTunnelSet(t *testing.T) {
+	web := []Tunnel{{Node: "web01", LocalPort: 8080, RemotePort: 80}}
+	db := []Tunnel{{Node: "db01", LocalPort: 5432, RemotePort: 5432}}
+
+	tests := []struct {
+		tunnels map[string][]Tunnel
+		name    string
+		want    []Tunnel
+		wantErr error
+	}{
+		{tunnels: map[string][]Tunnel{"default": web, "db": db}, name: "", want: web},
+		{tunnels: map[string][]Tunnel{"default": web, "db": db}, name: "DB", want: db},
+		// A single set needs no name
+		{tunnels: map[string][]Tunnel{"db": db}, name: "", want: db},
+		{tunnels: map[string][]Tunnel{"web": web, "db": db}, name: "", wantErr: ErrTunnelSetNotFound},
+		{tunnels: map[string][]Tunnel{"db": db}, name: "web", wantErr: ErrTunnelSetNotFound},
+		{tunnels: nil, name: "", wantErr: ErrTunnelSetNotFound},
+	}
+	for _, tt := range tests {
+		p := Profile{Name: "home", Tunnels: tt.tunnels}
+		got, err := p.TunnelSet(tt.name)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("TunnelSet(%q) of %v error = %v, want %v", tt.name, p.TunnelSetNames(), err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TunnelSet(%q) of %v = %+v, want %+v", tt.name, p.TunnelSetNames(), got, tt.want)
+		}
+	}
+
+	p := Profile{Name: "home", Tunnels: map[string][]Tunnel{"empty": {}}}
+	if _, err := p.TunnelSet("empty"); err == nil {
+		t.Error("TunnelSet of an empty set succeeded")
+	}
+}
+
+func TestTunnelSetsLoad(t *testing.T) {
+	loadTestConfig(t)
+	p, err := GetDefaultProfile()
+	if err != nil {
+		t.Fatal("GetDefaultProfile:", err)
+	}
+
+	if got, want := p.TunnelSetNames(), []string{"empty", "office"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TunnelSetNames() = %q, want %q", got, want)
+	}
+	for _, name := range []string{"Office", "office"} {
+		tunnels, err := p.TunnelSet(name)
+		if err != nil {
+			t.Fatalf("TunnelSet(%q): %v", name, err)
+		}
+		if !reflect.DeepEqual(tunnels, officeTunnels) {
+			t.Errorf("TunnelSet(%q) = %+v, want %+v", name, tunnels, officeTunnels)
+		}
+	}
+}
+
+func TestTunnelSetsSurviveSave(t *testing.T) {
+	path := loadTestConfig(t)
+	want := homeTunnels(t)
+
+	// Adding and removing other profiles rewrites the whole config
+	if _, err := AddProfile("work", false, "mesh.example.org", "admin", "secret"); err != nil {
+		t.Fatal("AddProfile:", err)
+	}
+	reloadConfig(t, path)
+	if got := homeTunnels(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("tunnels after AddProfile = %+v, want %+v", got, want)
+	}
+
+	if err := RemoveProfile("work"); err != nil {
+		t.Fatal("RemoveProfile:", err)
+	}
+	reloadConfig(t, path)
+	if got := homeTunnels(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("tunnels after RemoveProfile = %+v, want %+v", got, want)
+	}
+
+	// Removing the profile drops its tunnel sets
+	if err := RemoveProfile("home"); err != nil {
+		t.Fatal("RemoveProfile:", err)
+	}
+	reloadConfig(t, path)
+	profiles, err := GetProfiles()
+	if err != nil {
+		t.Fatal("GetProfiles:", err)
+	}
+	if len(profiles) != 0 {
+		t.Errorf("profiles after removing all = %+v, want none", profiles)
+	}
+}
@@ -0,0 +1,174 @@
+package meshcentraltest
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// handleControl serves control.ashx: it checks the login, then answers
+// authcookie, nodes, meshes and tunnel requests until the client disconnects.
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if reason := s.checkLogin(r); reason != nil {
+		reason["action"] = "close"
+		reason["cause"] = "noauth"
+		conn.WriteJSON(reason)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		return
+	}
+
+	s.mu.Lock()
+	s.logins++
+	s.controls[conn] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.controls, conn)
+		s.mu.Unlock()
+	}()
+
+	conn.WriteJSON(map[string]interface{}{
+		"action":     "serverinfo",
+		"serverinfo": map[string]interface{}{"name": s.Host()},
+	})
+
+	for {
+		var command struct {
+			Action     string `json:"action"`
+			ResponseID string `json:"responseid"`
+			NodeID     string `json:"nodeid"`
+			Type       string `json:"type"`
+			Value      string `json:"value"`
+		}
+		if err := conn.ReadJSON(&command); err != nil {
+			return
+		}
+
+		if reply, ok := s.Replies[command.Action]; ok {
+			conn.WriteMessage(websocket.TextMessage, []byte(reply))
+			continue
+		}
+
+		switch command.Action {
+		case "authcookie":
+			conn.WriteJSON(map[string]interface{}{
+				"action":  "authcookie",
+				"cookie":  s.newCookie(),
+				"rcookie": s.newCookie(),
+			})
+		case "nodes":
+			conn.WriteJSON(map[string]interface{}{
+				"action":     "nodes",
+				"responseid": command.ResponseID,
+				"nodes":      s.nodesByMesh(),
+			})
+		case "meshes":
+			if s.IgnoreMeshes {
+				continue
+			}
+			// Like MeshCentral, without the responseid
+			conn.WriteJSON(map[string]interface{}{
+				"action": "meshes",
+				"meshes": s.meshes(),
+			})
+		case "ping":
+			conn.WriteJSON(map[string]interface{}{"action": "pong"})
+		case "msg":
+			if command.Type == "tunnel" {
+				s.acceptTunnel(command.NodeID, command.Value)
+			}
+			conn.WriteJSON(map[string]interface{}{
+				"action":     "msg",
+				"result":     "OK",
+				"responseid": command.ResponseID,
+			})
+		}
+	}
+}
+
+// checkLogin validates the cookie or credentials of a control connection.
+// It returns the fields of the close message to send if the login fails.
+func (s *Server) checkLogin(r *http.Request) map[string]interface{} {
+	if cookie := r.URL.Query().Get("auth"); cookie != "" {
+		if s.validCookie(cookie) {
+			return nil
+		}
+		return map[string]interface{}{"msg": "badcookie"}
+	}
+
+	var username, password, token string
+	for i, part := range strings.Split(r.Header.Get("x-meshauth"), ",") {
+		value, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return map[string]interface{}{"msg": "badargs"}
+		}
+		switch i {
+		case 0:
+			username = string(value)
+		case 1:
+			password = string(value)
+		case 2:
+			token = string(value)
+		}
+	}
+
+	if username != s.Username || password != s.Password {
+		return map[string]interface{}{"msg": "badcredentials"}
+	}
+	if s.Token != "" && token != s.Token {
+		return map[string]interface{}{
+			"msg":          "tokenrequired",
+			"email2fa":     s.Email2FA,
+			"sms2fa":       s.SMS2FA,
+			"email2fasent": token == "**email**" && s.Email2FA,
+		}
+	}
+	return nil
+}
+
+// nodesByMesh groups the nodes by device group, as the nodes reply does.
+func (s *Server) nodesByMesh() map[string][]Node {
+	nodes := make(map[string][]Node)
+	for _, n := range s.Nodes {
+		meshID := n.MeshID
+		if meshID == "" {
+			meshID = "mesh//default"
+		}
+		nodes[meshID] = append(nodes[meshID], n)
+	}
+	return nodes
+}
+
+// meshes returns the device groups to list.
+func (s *Server) meshes() []Mesh {
+	if len(s.Meshes) == 0 {
+		return []Mesh{{ID: "mesh//default", Name: "Default"}}
+	}
+	return s.Meshes
+}
+
+// acceptTunnel records a relay session an agent was asked to join. The fake
+// agent joins once the client connects to the session.
+func (s *Server) acceptTunnel(nodeID string, value string) {
+	u, err := url.Parse(strings.TrimPrefix(value, "*"))
+	if err != nil {
+		return
+	}
+	query := u.Query()
+	if query.Get("nodeid") != nodeID || !s.validCookie(query.Get("rauth")) {
+		return
+	}
+
+	s.mu.Lock()
+	s.tunnels[query.Get("id")] = nodeID
+	s.mu.Unlock()
+}
@@ -0,0 +1,253 @@
+package meshcentraltest
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// handleRelay serves meshrelay.ashx for TCP tunnels (tcpport, tcpaddr), UDP
+// tunnels (udpport, udpaddr) and for terminal sessions previously requested
+// on the control channel.
+func (s *Server) handleRelay(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !s.validCookie(query.Get("auth")) {
+		http.Error(w, "invalid auth cookie", http.StatusUnauthorized)
+		return
+	}
+
+	if tcpport := query.Get("tcpport"); tcpport != "" {
+		port, err := strconv.Atoi(tcpport)
+		if err != nil {
+			http.Error(w, "invalid tcpport", http.StatusBadRequest)
+			return
+		}
+		s.addRelay(Relay{NodeID: query.Get("nodeid"), Target: query.Get("tcpaddr"), Port: port})
+		s.relayTCP(w, r, query.Get("nodeid"), query.Get("tcpaddr"), port)
+		return
+	}
+	if udpport := query.Get("udpport"); udpport != "" {
+		port, err := strconv.Atoi(udpport)
+		if err != nil {
+			http.Error(w, "invalid udpport", http.StatusBadRequest)
+			return
+		}
+		s.addRelay(Relay{NodeID: query.Get("nodeid"), UDP: true, Target: query.Get("udpaddr"), Port: port})
+		s.relayUDP(w, r, query.Get("nodeid"), query.Get("udpaddr"), port)
+		return
+	}
+
+	nodeID, ok := s.takeTunnel(query.Get("id"))
+	if !ok || nodeID != query.Get("nodeid") {
+		http.Error(w, "unknown relay session", http.StatusNotFound)
+		return
+	}
+	s.relayTerminal(w, r)
+}
+
+// addRelay records a tunnel for Relays.
+func (s *Server) addRelay(relay Relay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relays = append(s.relays, relay)
+}
+
+// takeTunnel claims a relay session requested on the control channel. The
+// client may join before the request was processed, so wait a little.
+func (s *Server) takeTunnel(id string) (string, bool) {
+	for i := 0; i < 50; i++ {
+		s.mu.Lock()
+		nodeID, ok := s.tunnels[id]
+		delete(s.tunnels, id)
+		s.mu.Unlock()
+		if ok {
+			return nodeID, true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return "", false
+}
+
+// relayConn is the server end of a relay websocket, written to by both the
+// data pump and control message replies.
+type relayConn struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *relayConn) write(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.WriteMessage(messageType, data)
+}
+
+// handleControl handles a tunnel control message like an agent, which only
+// acts on close. It returns false if the session should end.
+func (c *relayConn) handleControl(data []byte) bool {
+	var control struct {
+		CtrlChannel json.RawMessage `json:"ctrlChannel"`
+		Type        string          `json:"type"`
+	}
+	if json.Unmarshal(data, &control) != nil || control.CtrlChannel == nil {
+		return true
+	}
+	return control.Type != "close"
+}
+
+// relayTCP connects a TCP tunnel and copies data both ways.
+func (s *Server) relayTCP(w http.ResponseWriter, r *http.Request, nodeID string, target string, port int) {
+	dial := s.DialTCP
+	if dial == nil {
+		dial = dialEcho
+	}
+	tcpConn, err := dial(nodeID, target, port)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer tcpConn.Close()
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &relayConn{Conn: ws}
+	defer conn.Close()
+
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 32768)
+		for {
+			n, err := tcpConn.Read(buf)
+			if err != nil {
+				return
+			}
+			if conn.write(websocket.BinaryMessage, buf[:n]) != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.TextMessage {
+			if !conn.handleControl(data) {
+				return
+			}
+			continue
+		}
+		if _, err := tcpConn.Write(data); err != nil {
+			return
+		}
+	}
+}
+
+// relayUDP connects a UDP tunnel, carrying one datagram per message. Without
+// DialUDP every datagram is echoed back.
+func (s *Server) relayUDP(w http.ResponseWriter, r *http.Request, nodeID string, target string, port int) {
+	var udpConn net.Conn
+	if s.DialUDP != nil {
+		var err error
+		udpConn, err = s.DialUDP(nodeID, target, port)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer udpConn.Close()
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &relayConn{Conn: ws}
+	defer conn.Close()
+
+	if udpConn != nil {
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 65535)
+			for {
+				n, err := udpConn.Read(buf)
+				if err != nil {
+					return
+				}
+				if conn.write(websocket.BinaryMessage, buf[:n]) != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.TextMessage {
+			if !conn.handleControl(data) {
+				return
+			}
+			continue
+		}
+		if udpConn == nil {
+			err = conn.write(websocket.BinaryMessage, data)
+		} else {
+			_, err = udpConn.Write(data)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// relayTerminal plays the agent side of a terminal session: it announces
+// itself with "c", waits for the options and protocol, then echoes all
+// input back like a terminal with local echo.
+func (s *Server) relayTerminal(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &relayConn{Conn: ws}
+	defer conn.Close()
+
+	if conn.write(websocket.TextMessage, []byte("c")) != nil {
+		return
+	}
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.TextMessage {
+			if !conn.handleControl(data) {
+				return
+			}
+			continue
+		}
+		if conn.write(websocket.BinaryMessage, data) != nil {
+			return
+		}
+	}
+}
+
+// dialEcho returns a connection to an in-memory echo service.
+func dialEcho(nodeID string, target string, port int) (net.Conn, error) {
+	client, service := net.Pipe()
+	go func() {
+		defer service.Close()
+		io.Copy(service, service)
+	}()
+	return client, nil
+}
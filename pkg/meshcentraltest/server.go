@@ -0,0 +1,185 @@
+// Package meshcentraltest provides an in-process MeshCentral server for
+// testing code built on meshctl without a live server.
+//
+// The fake speaks enough of control.ashx and meshrelay.ashx to log in (with
+// optional 2FA), hand out auth cookies, answer nodes and meshes requests and relay TCP
+// and UDP tunnels and terminal sessions to local echo services:
+//
+//	srv := meshcentraltest.NewServer("admin", "secret")
+//	defer srv.Close()
+//	srv.Nodes = []meshcentraltest.Node{{ID: "node//abc", Name: "web01", Pwr: 1}}
+//
+//	client := meshctl.NewClient(srv.Host(), "admin", "secret")
+//	client.Insecure = true // the server uses a self-signed certificate
+package meshcentraltest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Node is a device reported by the fake server. The json tags match the
+// fields of a nodes reply.
+type Node struct {
+	ID          string    `json:"_id"`
+	MeshID      string    `json:"meshid"`
+	Domain      string    `json:"domain"`
+	Name        string    `json:"name"`
+	RName       string    `json:"rname"`
+	Desc        string    `json:"desc,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	OSDesc      string    `json:"osdesc"`
+	IP          string    `json:"ip"`
+	Icon        int       `json:"icon"`
+	Conn        int       `json:"conn"`
+	Pwr         int       `json:"pwr"`
+	Agent       NodeAgent `json:"agent"`
+	LastConnect int64     `json:"lastconnect,omitempty"` // ms since the epoch
+	Consent     int       `json:"consent,omitempty"`
+}
+
+// NodeAgent describes the agent of a Node.
+type NodeAgent struct {
+	Ver int `json:"ver"`
+	ID  int `json:"id"`
+}
+
+// Mesh is a device group reported by the fake server. Nodes without a
+// MeshID are in "mesh//default", which is listed if Meshes is empty.
+type Mesh struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Desc string `json:"desc,omitempty"`
+}
+
+// Server is a fake MeshCentral server listening on a local TLS port.
+// Configure its fields before the first client connects.
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+
+	// Token, if set, is the 2FA token every password login must carry.
+	// Email2FA and SMS2FA advertise the out-of-band token options.
+	Token    string
+	Email2FA bool
+	SMS2FA   bool
+
+	Nodes  []Node
+	Meshes []Mesh
+
+	// IgnoreMeshes leaves meshes requests unanswered.
+	IgnoreMeshes bool
+
+	// Replies holds raw messages answering the requests of an action
+	// instead of the usual reply, e.g. to send malformed ones.
+	Replies map[string]string
+
+	// DialTCP connects a TCP tunnel to its destination. Target is empty
+	// for the node itself. By default every tunnel is connected to an echo
+	// service.
+	DialTCP func(nodeID string, target string, port int) (net.Conn, error)
+
+	// DialUDP connects a UDP tunnel to its destination, each Read and Write
+	// carrying one datagram. By default every datagram is echoed back.
+	DialUDP func(nodeID string, target string, port int) (net.Conn, error)
+
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	relays   []Relay
+	cookies  map[string]bool
+	tunnels  map[string]string // relay session id -> node id
+	controls map[*websocket.Conn]bool
+	logins   int
+}
+
+// NewServer starts a fake server accepting the given credentials.
+func NewServer(username string, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		cookies:  make(map[string]bool),
+		tunnels:  make(map[string]string),
+		controls: make(map[*websocket.Conn]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control.ashx", s.handleControl)
+	mux.HandleFunc("/meshrelay.ashx", s.handleRelay)
+	s.Server = httptest.NewTLSServer(mux)
+	return s
+}
+
+// Host returns the host:port to pass to meshctl.NewClient.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// Relay is a TCP or UDP tunnel requested from meshrelay.ashx.
+type Relay struct {
+	NodeID string
+	UDP    bool
+	// Target is the tcpaddr or udpaddr, empty for the node itself
+	Target string
+	Port   int
+}
+
+// Relays returns the TCP and UDP tunnels requested so far, in order.
+func (s *Server) Relays() []Relay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.relays)
+}
+
+// Logins returns the number of successful logins so far.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// DropConnections closes every open control connection without a close
+// message, as a server restart would. Issued cookies stay valid.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.controls {
+		conn.Close()
+		delete(s.controls, conn)
+	}
+}
+
+// ExpireCookies invalidates every auth cookie issued so far.
+func (s *Server) ExpireCookies() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cookies = make(map[string]bool)
+}
+
+// newCookie issues a random auth cookie.
+func (s *Server) newCookie() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	cookie := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.cookies[cookie] = true
+	s.mu.Unlock()
+	return cookie
+}
+
+func (s *Server) validCookie(cookie string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cookies[cookie]
+}
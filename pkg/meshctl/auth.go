@@ -0,0 +1,337 @@
+package meshctl
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AuthError is returned when the server rejects the login. Code is the
+// reason reported by the server, e.g. "tokenrequired", "badtlscert",
+// "badargs" or "badcredentials". It wraps the matching Err* value.
+type AuthError struct {
+	Code      string
+	Message   string
+	Email2FA  bool // the account can receive a token by email
+	SMS2FA    bool // the account can receive a token by SMS
+	EmailSent bool // the server already sent a token by email
+}
+
+func (e AuthError) Error() string {
+	return e.Message
+}
+
+func (e AuthError) Unwrap() error {
+	switch e.Code {
+	case "tokenrequired":
+		return ErrTokenRequired
+	case "badtlscert":
+		return ErrBadTLSCert
+	case "badargs":
+		return ErrBadArgs
+	default:
+		return ErrBadCredentials
+	}
+}
+
+// Connect opens the control connection and authenticates. When the server
+// asks for a 2FA token, TokenPrompt is called and the login is retried if it
+// returns true. Each attempt is bounded by the client's Timeout. Rejected
+// logins are returned as AuthError. Forwards and shells started before
+// Connect wait for the login.
+func (c *Client) Connect(ctx context.Context) error {
+	return c.login(ctx)
+}
+
+// login authenticates with the configured credentials, asking TokenPrompt
+// for a 2FA token as often as the server requires one.
+func (c *Client) login(ctx context.Context) error {
+	for {
+		err := c.connectOnce(ctx, c.authCookie())
+		if ae, ok := err.(AuthError); ok && ae.Code == "tokenrequired" {
+			if c.TokenPrompt == nil || !c.TokenPrompt(ae) {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+}
+
+func (c *Client) connectOnce(ctx context.Context, authCookie string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var options *url.URL
+	var err error
+
+	options, err = url.Parse(strings.Replace(c.ServerURL, "meshrelay.ashx", "control.ashx", 1))
+	if err != nil {
+		return fmt.Errorf("unable to parse server URL: %w", err)
+	}
+
+	xtoken := c.xtoken()
+
+	headers := http.Header{}
+	if c.serverID == "" {
+		if authCookie != "" {
+			query := url.Values{}
+			query.Set("auth", authCookie)
+			if xtoken != "" {
+				query.Set("token", xtoken)
+			}
+			options.RawQuery = query.Encode()
+		} else {
+			auth := base64.StdEncoding.EncodeToString([]byte(c.Username)) + "," +
+				base64.StdEncoding.EncodeToString([]byte(c.Password))
+			if xtoken != "" {
+				auth += "," + base64.StdEncoding.EncodeToString([]byte(xtoken))
+			}
+			headers.Add("x-meshauth", auth)
+		}
+	} else {
+		headers.Add("x-meshauth", "*")
+	}
+
+	conn, _, err := c.dialer().DialContext(ctx, options.String(), headers)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnectFailed, err)
+	}
+
+	c.debugf("Connected to server.")
+
+	// Owned by this connection's reader, a reconnect makes new ones
+	loggedIn := make(chan struct{})
+	authErr := make(chan error, 1)
+	closed := make(chan struct{})
+
+	control := newSafeConn(conn)
+	c.connMu.Lock()
+	c.webSocket = control
+	c.connMu.Unlock()
+
+	c.pendingMu.Lock()
+	c.serverClosed = closed
+	c.pendingMu.Unlock()
+	go c.onServerWebSocket(control, closed, loggedIn, authErr)
+
+	select {
+	case <-loggedIn:
+		return nil
+	case err := <-authErr:
+		c.closeConnection()
+		return err
+	case <-ctx.Done():
+		c.closeConnection()
+		return ctx.Err()
+	}
+}
+
+// dialer returns a websocket dialer honoring the client's TLS settings.
+func (c *Client) dialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: c.Insecure,
+		},
+	}
+}
+
+// xtoken returns the 2FA token to send, if any.
+func (c *Client) xtoken() string {
+	if c.EmailToken {
+		return "**email**"
+	} else if c.SMSToken {
+		return "**sms**"
+	}
+	return c.Token
+}
+
+// onServerWebSocket reads the control connection conn until it fails. It
+// closes loggedIn once the login succeeded, or sends the reason it was
+// rejected on authErr, and closes closed when it returns.
+func (c *Client) onServerWebSocket(conn *safeConn, closed chan struct{}, loggedIn chan struct{}, authErr chan error) {
+	// Fail any request still waiting for a reply
+	defer close(closed)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			c.connMu.Lock()
+			closedByUs := c.webSocket != conn
+			c.connMu.Unlock()
+
+			if closedByUs {
+				return
+			} else if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				c.debugf("Server closed connection")
+			} else {
+				c.logf("Server connection error: %v", err)
+			}
+			c.onConnectionLost(conn, loggedIn, err)
+			return
+		}
+
+		var envelope serverMessage
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			c.logf("Error parsing command: %v", err)
+			continue
+		}
+
+		if c.dispatchResponse(envelope.ResponseID, envelope.Action, message) {
+			continue
+		}
+
+		if err := c.handleCommand(conn, envelope.Action, message, loggedIn, authErr); err != nil {
+			c.logf("Error parsing %s command: %v", envelope.Action, err)
+		}
+	}
+}
+
+// handleCommand handles an unsolicited message from the server on conn,
+// whose reader owns loggedIn and authErr.
+func (c *Client) handleCommand(conn *safeConn, action string, message []byte, loggedIn chan struct{}, authErr chan error) error {
+	switch action {
+	case "close":
+		var command closeMessage
+		if err := json.Unmarshal(message, &command); err != nil {
+			return err
+		}
+		c.handleCloseCommand(command, authErr)
+	case "serverinfo":
+		var command serverInfoMessage
+		if err := json.Unmarshal(message, &command); err != nil {
+			return err
+		}
+		conn.WriteJSON(actionRequest{Action: "authcookie"})
+	case "authcookie":
+		var command authCookieMessage
+		if err := json.Unmarshal(message, &command); err != nil {
+			return err
+		}
+		c.handleAuthCookieCommand(command, loggedIn)
+	case "serverAuth":
+		var command serverAuthMessage
+		if err := json.Unmarshal(message, &command); err != nil {
+			return err
+		}
+		c.handleServerAuthCommand(command)
+	}
+	return nil
+}
+
+func (c *Client) handleCloseCommand(command closeMessage, authErr chan error) {
+	if command.Cause == "noauth" {
+		switch command.Msg {
+		case "tokenrequired":
+			sendAuthError(authErr, AuthError{
+				Code:      "tokenrequired",
+				Message:   "login token required",
+				Email2FA:  command.Email2FA,
+				SMS2FA:    command.SMS2FA,
+				EmailSent: command.Email2FASent,
+			})
+		case "badtlscert":
+			sendAuthError(authErr, AuthError{Code: "badtlscert", Message: "invalid TLS certificate detected"})
+		case "badargs":
+			sendAuthError(authErr, AuthError{Code: "badargs", Message: "invalid protocol arguments"})
+		default:
+			sendAuthError(authErr, AuthError{Code: "badcredentials", Message: "invalid username/password"})
+		}
+	} else {
+		c.debugf("Server disconnected: %v", command.Msg)
+	}
+}
+
+func (c *Client) handleAuthCookieCommand(command authCookieMessage, loggedIn chan struct{}) {
+	c.connMu.Lock()
+	c.aCookie = command.Cookie
+	c.rCookie = command.RCookie
+	// Logged in, the cookie we were given may expire
+	c.AuthCookie = ""
+	c.connMu.Unlock()
+	c.scheduleCookieRenewal()
+
+	// The first cookie on a connection completes the login
+	select {
+	case <-loggedIn:
+	default:
+		close(loggedIn)
+	}
+	select {
+	case <-c.webChannel:
+	default:
+		close(c.webChannel)
+	}
+}
+
+// authCookie returns AuthCookie, which the reader goroutine clears.
+func (c *Client) authCookie() string {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.AuthCookie
+}
+
+// cookies returns the current relay cookies: the auth cookie used to open
+// tunnels and the relay cookie handed to agents.
+func (c *Client) cookies() (aCookie string, rCookie string) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.aCookie, c.rCookie
+}
+
+// SessionCookie returns the current auth cookie of the session. While it is
+// valid, another client can log in with it as its AuthCookie, without a 2FA
+// token.
+func (c *Client) SessionCookie() string {
+	aCookie, _ := c.cookies()
+	return aCookie
+}
+
+// scheduleCookieRenewal asks for fresh cookies in 10 minutes, replacing any
+// renewal already pending.
+func (c *Client) scheduleCookieRenewal() {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	// Stop old timer before creating new one
+	if c.renewCookieTimer != nil {
+		c.renewCookieTimer.Stop()
+	}
+	c.renewCookieTimer = time.AfterFunc(10*time.Minute, func() {
+		c.send(actionRequest{Action: "authcookie"})
+	})
+}
+
+func (c *Client) handleServerAuthCommand(command serverAuthMessage) {
+	c.serverID = ""
+	c.serverHttpsHash = c.meshServerTlsHash
+	c.meshServerTlsHash = ""
+
+	auth := userAuthRequest{Action: "userAuth", Token: c.xtoken()}
+	if authCookie := c.authCookie(); authCookie != "" {
+		auth.Auth = authCookie
+	} else {
+		auth.Username = base64.StdEncoding.EncodeToString([]byte(c.Username))
+		auth.Password = base64.StdEncoding.EncodeToString([]byte(c.Password))
+	}
+
+	c.send(auth)
+}
+
+// sendAuthError reports a rejected login on authErr, unless one was
+// reported already.
+func sendAuthError(authErr chan error, err error) {
+	select {
+	case authErr <- err:
+	default:
+	}
+}
@@ -0,0 +1,204 @@
+package meshctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client holds the state of a single authenticated session with a
+// MeshCentral server. Several clients can be used side by side.
+type Client struct {
+	ServerURL  string
+	Username   string
+	Password   string
+	Token      string
+	EmailToken bool
+	SMSToken   bool
+	Insecure   bool
+	Debug      bool
+
+	// AuthCookie, if set, logs in instead of the username and password,
+	// e.g. with the SessionCookie of another client. It is cleared once
+	// the login succeeded, later logins use the credentials.
+	AuthCookie string
+
+	// Timeout bounds each round trip to the server, such as logging in or
+	// listing devices. Zero means no limit.
+	Timeout time.Duration
+
+	// UDPIdleTimeout closes the tunnel of a UDP forward's source address
+	// after this long without traffic. Zero means DefaultUDPIdleTimeout.
+	UDPIdleTimeout time.Duration
+
+	// AutoReconnect re-establishes the control connection when it is lost
+	// after a successful login, so that new tunnels can still be opened.
+	AutoReconnect bool
+
+	// OnDisconnect is called when the control connection is lost and a
+	// reconnect is about to start. OnReconnect is called once it succeeded.
+	OnDisconnect func(err error)
+	OnReconnect  func()
+
+	// Stdin and Stdout are attached to Shell and Proxy sessions. They
+	// default to the standard input and output of the process.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Log receives diagnostics that cannot be returned to a caller, such as
+	// a failed connection of a forward, reconnects and the Debug output.
+	// Nil means the standard error of the process.
+	Log io.Writer
+
+	// TokenPrompt is called when the server requires a 2FA token. It should
+	// apply the token with SetToken and return true to retry the login.
+	TokenPrompt func(err AuthError) bool
+
+	serverID              string
+	serverAuthClientNonce string
+	meshServerTlsHash     string
+	serverHttpsHash       string
+
+	// connMu guards the connection, cookies and timers, which are replaced
+	// from the reader goroutine, reconnects and Close
+	connMu           sync.Mutex
+	webSocket        *safeConn
+	webChannel       chan struct{} // closed once logged in
+	aCookie          string
+	rCookie          string
+	renewCookieTimer *time.Timer
+	stopReconnect    context.CancelFunc
+
+	// Running forwards, reported by Stats, and the latest round trip time
+	// measured by PingServer
+	statsMu  sync.Mutex
+	forwards []*forwardState
+	rtt      atomic.Int64
+
+	// Requests waiting for a reply, keyed by responseid
+	pendingMu     sync.Mutex
+	pending       map[string]*pendingRequest
+	lastRequestID uint64
+	serverClosed  chan struct{}
+}
+
+// NewClient returns a client for the given server hostname (ex:
+// mesh.example.com) and credentials. The connection is not opened until
+// Connect is called.
+func NewClient(server string, username string, password string) *Client {
+	return &Client{
+		ServerURL:  "wss://" + server + "/meshrelay.ashx",
+		Username:   username,
+		Password:   password,
+		webChannel: make(chan struct{}),
+	}
+}
+
+// SetToken sets the 2FA token used on the next authentication attempt.
+func (c *Client) SetToken(token string, emailToken bool, smsToken bool) {
+	c.Token = token
+	c.EmailToken = emailToken
+	c.SMSToken = smsToken
+}
+
+// stdio returns the reader and writer attached to sessions.
+func (c *Client) stdio() (io.Reader, io.Writer) {
+	var stdin io.Reader = os.Stdin
+	var stdout io.Writer = os.Stdout
+	if c.Stdin != nil {
+		stdin = c.Stdin
+	}
+	if c.Stdout != nil {
+		stdout = c.Stdout
+	}
+	return stdin, stdout
+}
+
+// logf writes a diagnostic line to Log.
+func (c *Client) logf(format string, args ...interface{}) {
+	var w io.Writer = os.Stderr
+	if c.Log != nil {
+		w = c.Log
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// debugf writes a diagnostic line to Log if Debug is set.
+func (c *Client) debugf(format string, args ...interface{}) {
+	if c.Debug {
+		c.logf(format, args...)
+	}
+}
+
+// withTimeout bounds ctx by the client's Timeout, if set.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout > 0 {
+		return context.WithTimeout(ctx, c.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Close stops cookie renewal and any reconnect in progress and closes the
+// control connection.
+func (c *Client) Close() {
+	c.connMu.Lock()
+	if c.stopReconnect != nil {
+		c.stopReconnect()
+		c.stopReconnect = nil
+	}
+	c.connMu.Unlock()
+
+	c.closeConnection()
+}
+
+// closeConnection stops cookie renewal and closes the current control
+// connection.
+func (c *Client) closeConnection() {
+	c.connMu.Lock()
+	// Stop timer before closing connection
+	if c.renewCookieTimer != nil {
+		c.renewCookieTimer.Stop()
+		c.renewCookieTimer = nil
+	}
+	conn := c.webSocket
+	c.webSocket = nil
+	c.connMu.Unlock()
+
+	if conn != nil {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(1000, "all done"))
+		// Don't sleep - if server closed us (tokenrequired), the write
+		// may already fail and sleeping just adds latency
+		conn.Close()
+	}
+}
+
+// send writes the JSON encoding of v on the control connection. It is safe
+// to call from any goroutine.
+func (c *Client) send(v interface{}) error {
+	c.connMu.Lock()
+	conn := c.webSocket
+	c.connMu.Unlock()
+
+	if conn == nil {
+		return ErrConnectionClosed
+	}
+	return conn.WriteJSON(v)
+}
+
+// relayURL returns the meshrelay.ashx URL with the given query parameters.
+func (c *Client) relayURL(query url.Values) (string, error) {
+	options, err := url.Parse(c.ServerURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse server URL: %w", err)
+	}
+	options.RawQuery = query.Encode()
+	return options.String(), nil
+}
@@ -0,0 +1,197 @@
+package meshctl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshcentraltest"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+const (
+	testUser     = "admin"
+	testPassword = "secret"
+	testNode     = "node//a$b@c/d"
+)
+
+// newServer starts a fake server with one online node, closed when the test
+// ends.
+func newServer(t *testing.T) *meshcentraltest.Server {
+	t.Helper()
+	srv := meshcentraltest.NewServer(testUser, testPassword)
+	t.Cleanup(srv.Close)
+	srv.Nodes = []meshcentraltest.Node{{ID: testNode, Name: "Web", RName: "web01", IP: "10.0.0.5", Pwr: 1, Conn: 1}}
+	return srv
+}
+
+// newClient returns a client for srv, closed when the test ends.
+func newClient(t *testing.T, srv *meshcentraltest.Server) *meshctl.Client {
+	t.Helper()
+	c := meshctl.NewClient(srv.Host(), testUser, testPassword)
+	c.Insecure = true
+	c.Timeout = 5 * time.Second
+	t.Cleanup(c.Close)
+	return c
+}
+
+// connect returns a client logged in to srv.
+func connect(t *testing.T, srv *meshcentraltest.Server) *meshctl.Client {
+	t.Helper()
+	c := newClient(t, srv)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+	return c
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits until b contains want.
+func waitForOutput(t *testing.T, b *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(b.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output %q does not contain %q", b.String(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	srv := newServer(t)
+	c := connect(t, srv)
+
+	if got := srv.Logins(); got != 1 {
+		t.Errorf("Logins() = %d, want 1", got)
+	}
+	if c.SessionCookie() == "" {
+		t.Error("SessionCookie() is empty after login")
+	}
+}
+
+func TestConnectBadCredentials(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv)
+	c.Password = "wrong"
+
+	err := c.Connect(context.Background())
+	if !errors.Is(err, meshctl.ErrBadCredentials) {
+		t.Fatalf("Connect() = %v, want ErrBadCredentials", err)
+	}
+	var ae meshctl.AuthError
+	if !errors.As(err, &ae) || ae.Code != "badcredentials" {
+		t.Errorf("Connect() = %#v, want an AuthError with code badcredentials", err)
+	}
+}
+
+func TestConnectTokenRequired(t *testing.T) {
+	srv := newServer(t)
+	srv.Token = "123456"
+	srv.Email2FA = true
+
+	// Without a prompt the login fails
+	c := newClient(t, srv)
+	err := c.Connect(context.Background())
+	if !errors.Is(err, meshctl.ErrTokenRequired) {
+		t.Fatalf("Connect() = %v, want ErrTokenRequired", err)
+	}
+	var ae meshctl.AuthError
+	if !errors.As(err, &ae) || !ae.Email2FA {
+		t.Errorf("Connect() = %#v, want an AuthError offering email", err)
+	}
+
+	// A prompt applying the token retries the login
+	c = newClient(t, srv)
+	prompts := 0
+	c.TokenPrompt = func(ae meshctl.AuthError) bool {
+		prompts++
+		c.SetToken(srv.Token, false, false)
+		return true
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect() with token:", err)
+	}
+	if prompts != 1 {
+		t.Errorf("TokenPrompt called %d times, want 1", prompts)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newServer(t)
+	c := newClient(t, srv)
+	c.AutoReconnect = true
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect = func() {
+		reconnected <- struct{}{}
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+
+	srv.DropConnections()
+	select {
+	case <-reconnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no reconnect after the connection dropped")
+	}
+
+	if _, err := c.Devices(context.Background()); err != nil {
+		t.Fatal("Devices after reconnect:", err)
+	}
+	if got := srv.Logins(); got != 2 {
+		t.Errorf("Logins() = %d, want 2", got)
+	}
+}
+
+func TestConnectAuthCookie(t *testing.T) {
+	srv := newServer(t)
+	first := connect(t, srv)
+
+	c := newClient(t, srv)
+	c.AutoReconnect = true
+	c.AuthCookie = first.SessionCookie()
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect = func() {
+		reconnected <- struct{}{}
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect with cookie:", err)
+	}
+	if c.AuthCookie != "" {
+		t.Errorf("AuthCookie = %q after login, want it cleared", c.AuthCookie)
+	}
+
+	// Once all cookies expired, the credentials log in again
+	srv.ExpireCookies()
+	srv.DropConnections()
+	select {
+	case <-reconnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no reconnect after the cookies expired")
+	}
+	if _, err := c.Devices(context.Background()); err != nil {
+		t.Fatal("Devices after reconnect:", err)
+	}
+}
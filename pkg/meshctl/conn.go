@@ -0,0 +1,33 @@
+package meshctl
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// safeConn is a websocket connection that may be written to from several
+// goroutines. gorilla/websocket supports only one concurrent writer, so all
+// data writes are serialized; reads must still come from a single goroutine.
+type safeConn struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+}
+
+func newSafeConn(conn *websocket.Conn) *safeConn {
+	return &safeConn{Conn: conn}
+}
+
+// WriteMessage writes a message, waiting for any write in progress.
+func (s *safeConn) WriteMessage(messageType int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.Conn.WriteMessage(messageType, data)
+}
+
+// WriteJSON writes the JSON encoding of v, waiting for any write in progress.
+func (s *safeConn) WriteJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.Conn.WriteJSON(v)
+}
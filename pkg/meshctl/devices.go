@@ -0,0 +1,141 @@
+package meshctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Device is a node known to the server.
+type Device struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`         // Hostname (rname)
+	DisplayName string `json:"display_name"` // Custom name from MeshCentral
+	OS          string `json:"os"`
+	IP          string `json:"ip"`
+	Icon        int    `json:"icon"`
+	Conn        int    `json:"conn"`
+	Pwr         int    `json:"pwr"`
+
+	// MeshID is the device group, MeshName its name if the groups could be
+	// listed.
+	MeshID   string `json:"mesh_id"`
+	MeshName string `json:"mesh_name,omitempty"`
+	Domain   string `json:"domain"`
+
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// AgentVersion and AgentType describe the MeshAgent, the type being
+	// MeshCentral's number for its platform and architecture.
+	AgentVersion int `json:"agent_version"`
+	AgentType    int `json:"agent_type"`
+
+	// LastConnect is when the agent last connected, zero if unknown.
+	LastConnect time.Time `json:"last_connect"`
+
+	// Consent is the bitmask of user consent flags set on the device.
+	Consent int `json:"consent"`
+}
+
+// Group is a device group (mesh) known to the server.
+type Group struct {
+	Id          string
+	Name        string
+	Description string
+}
+
+// parseNodes extracts the devices from a nodes reply.
+func parseNodes(message []byte) ([]Device, error) {
+	var command nodesMessage
+	if err := json.Unmarshal(message, &command); err != nil {
+		return nil, fmt.Errorf("invalid nodes reply: %w", err)
+	}
+
+	var devices []Device
+	for meshID, nodes := range command.Nodes {
+		for _, node := range nodes {
+			device := Device{
+				Id:           node.ID,
+				Name:         node.RName,
+				DisplayName:  node.Name,
+				OS:           node.OSDesc,
+				IP:           node.IP,
+				Icon:         node.Icon,
+				Conn:         node.Conn,
+				Pwr:          node.Pwr,
+				MeshID:       node.MeshID,
+				Domain:       node.Domain,
+				Description:  node.Desc,
+				Tags:         node.Tags,
+				AgentVersion: node.Agent.Ver,
+				AgentType:    node.Agent.ID,
+				Consent:      node.Consent,
+			}
+			if device.MeshID == "" {
+				device.MeshID = meshID
+			}
+			if node.LastConnect != 0 {
+				device.LastConnect = time.UnixMilli(node.LastConnect)
+			}
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, nil
+}
+
+// Devices queries the server for all devices visible to the user, with the
+// names of their device groups if those can be listed.
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	reply, err := c.request(ctx, &actionRequest{Action: "nodes"})
+	if err != nil {
+		return nil, err
+	}
+
+	c.debugf("Received nodes command")
+	devices, err := parseNodes(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without the groups, the devices are still worth listing
+	groups, err := c.Groups(ctx)
+	if err != nil {
+		c.debugf("Failed to list device groups: %v", err)
+		return devices, nil
+	}
+	names := make(map[string]string, len(groups))
+	for _, g := range groups {
+		names[g.Id] = g.Name
+	}
+	for i := range devices {
+		devices[i].MeshName = names[devices[i].MeshID]
+	}
+	return devices, nil
+}
+
+// Groups queries the server for the device groups visible to the user.
+func (c *Client) Groups(ctx context.Context) ([]Group, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	reply, err := c.request(ctx, &actionRequest{Action: "meshes"})
+	if err != nil {
+		return nil, err
+	}
+
+	var command meshesMessage
+	if err := json.Unmarshal(reply, &command); err != nil {
+		return nil, fmt.Errorf("invalid meshes reply: %w", err)
+	}
+	groups := make([]Group, len(command.Meshes))
+	for i, mesh := range command.Meshes {
+		groups[i] = Group{Id: mesh.ID, Name: mesh.Name, Description: mesh.Desc}
+	}
+	return groups, nil
+}
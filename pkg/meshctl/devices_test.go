@@ -0,0 +1,138 @@
+package meshctl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshcentraltest"
+)
+
+func TestDevices(t *testing.T) {
+	srv := newServer(t)
+	srv.Meshes = []meshcentraltest.Mesh{{ID: "mesh//office", Name: "Office"}}
+	srv.Nodes = []meshcentraltest.Node{{
+		ID:          testNode,
+		MeshID:      "mesh//office",
+		Name:        "Web",
+		RName:       "web01",
+		OSDesc:      "Ubuntu 22.04",
+		IP:          "10.0.0.5",
+		Pwr:         1,
+		Conn:        1,
+		Tags:        []string{"prod"},
+		Agent:       meshcentraltest.NodeAgent{Ver: 2, ID: 6},
+		LastConnect: 1700000000000,
+	}}
+	c := connect(t, srv)
+
+	devices, err := c.Devices(context.Background())
+	if err != nil {
+		t.Fatal("Devices:", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("Devices() returned %d devices, want 1", len(devices))
+	}
+	d := devices[0]
+	if d.Id != testNode || d.Name != "web01" || d.DisplayName != "Web" || d.OS != "Ubuntu 22.04" || d.IP != "10.0.0.5" {
+		t.Errorf("Devices() = %+v", d)
+	}
+	if d.MeshID != "mesh//office" || d.MeshName != "Office" {
+		t.Errorf("group = %q %q, want mesh//office Office", d.MeshID, d.MeshName)
+	}
+	if len(d.Tags) != 1 || d.Tags[0] != "prod" || d.AgentType != 6 || !d.LastConnect.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("details = %v %d %v", d.Tags, d.AgentType, d.LastConnect)
+	}
+}
+
+func TestDevicesMalformedReply(t *testing.T) {
+	srv := newServer(t)
+	srv.Replies = map[string]string{"nodes": `{"action":"nodes","nodes":["web01"]}`}
+	c := connect(t, srv)
+
+	if _, err := c.Devices(context.Background()); err == nil {
+		t.Fatal("Devices() succeeded on a malformed reply, want an error")
+	}
+}
+
+func TestDevicesUnparsableReply(t *testing.T) {
+	srv := newServer(t)
+	srv.Replies = map[string]string{"nodes": `{"action":"nodes",`}
+	c := newClient(t, srv)
+	c.Timeout = time.Second
+	var log, stdout syncBuffer
+	c.Log = &log
+	c.Stdout = &stdout
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+
+	// A reply that cannot be attributed to the request is only logged
+	if _, err := c.Devices(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Devices() = %v, want context.DeadlineExceeded", err)
+	}
+	waitForOutput(t, &log, "Error parsing command")
+	if stdout.String() != "" {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+}
+
+func TestDevicesWithoutGroups(t *testing.T) {
+	srv := newServer(t)
+	srv.IgnoreMeshes = true
+	c := newClient(t, srv)
+	c.Timeout = time.Second
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+
+	devices, err := c.Devices(context.Background())
+	if err != nil {
+		t.Fatal("Devices:", err)
+	}
+	if len(devices) != 1 || devices[0].Id != testNode || devices[0].MeshName != "" {
+		t.Errorf("Devices() = %+v, want the node without a group name", devices)
+	}
+}
+
+func TestDevicesConcurrent(t *testing.T) {
+	srv := newServer(t)
+	srv.Meshes = []meshcentraltest.Mesh{{ID: "mesh//office", Name: "Office"}}
+	srv.Nodes[0].MeshID = "mesh//office"
+	c := connect(t, srv)
+
+	// Meshes replies carry no responseid, each must reach a different caller
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			groups, err := c.Groups(ctx)
+			if err == nil && (len(groups) != 1 || groups[0].Name != "Office") {
+				err = fmt.Errorf("Groups() = %+v", groups)
+			}
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			devices, err := c.Devices(ctx)
+			if err == nil && (len(devices) != 1 || devices[0].MeshName != "Office") {
+				err = fmt.Errorf("Devices() = %+v", devices)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package meshctl is a client for the MeshCentral WebSocket API.
+//
+// A Client authenticates against the control channel (control.ashx) of a
+// MeshCentral server and uses the resulting cookies to open relay
+// connections (meshrelay.ashx) to devices:
+//
+//	client := meshctl.NewClient("mesh.example.com", "admin", "secret")
+//	if err := client.Connect(ctx); err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	devices, err := client.Devices(ctx)
+//
+// Connected clients can forward local TCP ports to devices with Route and
+// Proxy, and open terminal sessions with Shell.
+//
+// The package follows the semantic version of the module: exported
+// identifiers are not changed incompatibly within a major version.
+package meshctl
@@ -0,0 +1,25 @@
+package meshctl
+
+import "errors"
+
+// Errors returned by the client. Use errors.Is to test for them, they are
+// usually wrapped with more detail.
+var (
+	// ErrBadCredentials means the server rejected the username or password.
+	ErrBadCredentials = errors.New("invalid username/password")
+	// ErrTokenRequired means the login needs a 2FA token that was not
+	// given, or was wrong.
+	ErrTokenRequired = errors.New("login token required")
+	// ErrBadTLSCert means the server rejected the TLS certificate it saw,
+	// e.g. because of a proxy in between.
+	ErrBadTLSCert = errors.New("invalid TLS certificate detected")
+	// ErrBadArgs means the server did not understand the login request.
+	ErrBadArgs = errors.New("invalid protocol arguments")
+	// ErrConnectFailed means the server could not be reached.
+	ErrConnectFailed = errors.New("unable to connect to server")
+	// ErrConnectionClosed means the control connection went away while a
+	// request was waiting for its reply.
+	ErrConnectionClosed = errors.New("control connection closed")
+	// ErrBindFailed means a local listener could not be opened.
+	ErrBindFailed = errors.New("unable to bind local port")
+)
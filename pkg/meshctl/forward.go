@@ -0,0 +1,240 @@
+package meshctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// localAddress returns the host:port to listen on for a bind address and
+// port. An empty bind address means the loopback interface, "*" means all
+// interfaces.
+func localAddress(bindAddress string, port int) string {
+	switch bindAddress {
+	case "":
+		bindAddress = "127.0.0.1"
+	case "*":
+		bindAddress = ""
+	}
+	return net.JoinHostPort(bindAddress, strconv.Itoa(port))
+}
+
+// listen opens the local listener of f: a unix socket if LocalPath is set,
+// otherwise a TCP port.
+func listen(f Forward) (net.Listener, error) {
+	if f.LocalPath == "" {
+		address := localAddress(f.BindAddress, f.LocalPort)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: TCP %s: %v", ErrBindFailed, address, err)
+		}
+		return listener, nil
+	}
+
+	listener, err := net.Listen("unix", f.LocalPath)
+	if err != nil && removeStaleSocket(f.LocalPath) {
+		listener, err = net.Listen("unix", f.LocalPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: socket %s: %v", ErrBindFailed, f.LocalPath, err)
+	}
+
+	// The socket reaches into the remote network, keep it to ourselves
+	if err := os.Chmod(f.LocalPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("%w: socket %s: %v", ErrBindFailed, f.LocalPath, err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket at path if nothing is listening on
+// it any more, as left behind by a crashed process. It returns true if the
+// socket was removed.
+func removeStaleSocket(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return false
+	}
+	return os.Remove(path) == nil
+}
+
+// serve accepts connections on listener and runs handle for each of them in
+// its own goroutine, until ctx is cancelled or the listener is closed. It
+// returns once all handlers are done.
+func (c *Client) serve(ctx context.Context, listener net.Listener, handle func(conn net.Conn)) error {
+	// Unblock Accept once we are cancelled
+	stop := context.AfterFunc(ctx, func() {
+		listener.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			c.logf("Error accepting connection: %v", err)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle(conn)
+		}()
+	}
+}
+
+// pump copies data between a relay tunnel and a local connection until
+// either side closes or ctx is cancelled, then closes both. It returns once
+// everything received from the tunnel was written to the local side. The
+// traffic is recorded in state.
+func (c *Client) pump(ctx context.Context, wsConn *safeConn, local io.ReadWriteCloser, state *forwardState) {
+	c.debugf("Websocket connected")
+
+	var once sync.Once
+	closeAll := func() {
+		once.Do(func() {
+			wsConn.Close()
+			local.Close()
+		})
+	}
+	stop := context.AfterFunc(ctx, closeAll)
+	defer stop()
+
+	// Tunnel -> local. Waited for, so no write happens after we return.
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		defer closeAll()
+		for {
+			messageType, message, err := wsConn.ReadMessage()
+			if err != nil {
+				if c.Debug && !errors.Is(err, net.ErrClosed) && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					c.logf("WebSocket read error: %v", err)
+				}
+				return
+			}
+			if messageType != websocket.BinaryMessage || len(message) == 0 {
+				continue
+			}
+			if _, err := local.Write(message); err != nil {
+				c.debugf("Local write error: %v", err)
+				return
+			}
+			state.bytesIn.Add(int64(len(message)))
+		}
+	}()
+
+	// Local -> tunnel. Not waited for: a read from stdin cannot be
+	// interrupted, other connections fail their read once closed.
+	go func() {
+		defer closeAll()
+		buf := make([]byte, 32768)
+		for {
+			n, err := local.Read(buf)
+			if n > 0 {
+				if err := wsConn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					c.debugf("WebSocket write error: %v", err)
+					return
+				}
+				state.bytesOut.Add(int64(n))
+			}
+			if err != nil {
+				if c.Debug && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+					c.logf("Local read error: %v", err)
+				}
+				return
+			}
+		}
+	}()
+
+	<-received
+}
+
+// stdioListener is a net.Listener that accepts a single connection made of
+// a reader and a writer, such as the standard input and output. Accept
+// fails with net.ErrClosed once that connection is closed.
+type stdioListener struct {
+	conn     *stdioConn
+	accepted bool
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newStdioListener(r io.Reader, w io.Writer) *stdioListener {
+	return &stdioListener{
+		conn:   &stdioConn{Reader: r, Writer: w, closed: make(chan struct{})},
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *stdioListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	select {
+	case <-l.conn.closed:
+	case <-l.closed:
+	}
+	return nil, net.ErrClosed
+}
+
+func (l *stdioListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *stdioListener) Addr() net.Addr {
+	return stdioAddr{}
+}
+
+// stdioConn adapts a reader and a writer to net.Conn. Closing it does not
+// close them, the process owns the standard streams.
+type stdioConn struct {
+	io.Reader
+	io.Writer
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *stdioConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *stdioConn) LocalAddr() net.Addr                { return stdioAddr{} }
+func (c *stdioConn) RemoteAddr() net.Addr               { return stdioAddr{} }
+func (c *stdioConn) SetDeadline(t time.Time) error      { return nil }
+func (c *stdioConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *stdioConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
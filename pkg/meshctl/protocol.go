@@ -0,0 +1,179 @@
+package meshctl
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// This file documents the parts of the MeshCentral wire protocol the client
+// depends on. Messages on the control channel (control.ashx) are JSON
+// objects dispatched on their "action" field. Unknown actions and unknown
+// fields are ignored, so newer servers keep working.
+
+// serverMessage holds the fields common to every control channel message.
+type serverMessage struct {
+	Action string `json:"action"`
+	// ResponseID echoes the responseid of the request being answered.
+	ResponseID string `json:"responseid,omitempty"`
+}
+
+// closeMessage is sent by the server right before it closes the control
+// channel, e.g. because the login was rejected.
+type closeMessage struct {
+	// Cause is "noauth" when the login failed.
+	Cause string `json:"cause"`
+	// Msg is the reason, e.g. "tokenrequired", "badtlscert" or "badargs".
+	Msg          string `json:"msg"`
+	Email2FA     bool   `json:"email2fa"`
+	SMS2FA       bool   `json:"sms2fa"`
+	Email2FASent bool   `json:"email2fasent"`
+}
+
+// serverInfoMessage is the first message after a successful login. The
+// server details it carries are not used.
+type serverInfoMessage struct {
+	ServerInfo json.RawMessage `json:"serverinfo"`
+}
+
+// authCookieMessage answers an authcookie request. Cookie authenticates
+// relay connections made by us, RCookie is handed to agents so they can
+// join a relay session we requested.
+type authCookieMessage struct {
+	Cookie  string `json:"cookie"`
+	RCookie string `json:"rcookie"`
+}
+
+// serverAuthMessage asks the client to send its user credentials. It is
+// only used when connecting through a peer server.
+type serverAuthMessage struct{}
+
+// nodesMessage answers a nodes request with the devices the user can see,
+// grouped by device group (mesh) id.
+type nodesMessage struct {
+	Nodes map[string][]nodeInfo `json:"nodes"`
+}
+
+// nodeInfo is a single device in a nodes reply.
+type nodeInfo struct {
+	ID     string   `json:"_id"`
+	MeshID string   `json:"meshid"`
+	Domain string   `json:"domain"`
+	Name   string   `json:"name"`
+	RName  string   `json:"rname"`
+	Desc   string   `json:"desc"`
+	Tags   []string `json:"tags"`
+	OSDesc string   `json:"osdesc"`
+	IP     string   `json:"ip"`
+	Icon   int      `json:"icon"`
+	Conn   int      `json:"conn"`
+	Pwr    int      `json:"pwr"`
+	Agent  struct {
+		Ver int `json:"ver"`
+		ID  int `json:"id"` // agent type
+	} `json:"agent"`
+	// LastConnect is in milliseconds since the epoch
+	LastConnect int64 `json:"lastconnect"`
+	// Consent is the bitmask of user consent flags set on the device
+	Consent int `json:"consent"`
+}
+
+// meshesMessage answers a meshes request with the device groups the user
+// can see. Servers do not always echo the responseid of this request.
+type meshesMessage struct {
+	Meshes []meshInfo `json:"meshes"`
+}
+
+// meshInfo is a single device group in a meshes reply.
+type meshInfo struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Desc string `json:"desc"`
+}
+
+// Messages sent by the client are always marshalled from the structs below,
+// never assembled by hand, so that ids, cookies and tokens are escaped.
+
+// requestMessage is a message that can be correlated with its reply.
+type requestMessage interface {
+	setResponseID(id string)
+	// replyAction is the action of a reply that may lack the responseid,
+	// or "" if replies always carry it.
+	replyAction() string
+}
+
+// actionRequest is a request without arguments, such as "authcookie",
+// "nodes" or "meshes". Its reply carries the same action.
+type actionRequest struct {
+	Action     string `json:"action"`
+	ResponseID string `json:"responseid,omitempty"`
+}
+
+func (r *actionRequest) setResponseID(id string) { r.ResponseID = id }
+func (r *actionRequest) replyAction() string     { return r.Action }
+
+// pingRequest asks the server for a "pong", which never carries the
+// responseid.
+type pingRequest struct {
+	Action     string `json:"action"` // "ping"
+	ResponseID string `json:"responseid,omitempty"`
+}
+
+func (r *pingRequest) setResponseID(id string) { r.ResponseID = id }
+func (r *pingRequest) replyAction() string     { return "pong" }
+
+// userAuthRequest answers serverAuth with either an auth cookie or the
+// base64 encoded username and password, plus an optional 2FA token.
+type userAuthRequest struct {
+	Action   string `json:"action"` // "userAuth"
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// tunnelRequest asks an agent to join a relay session. Value is the relay
+// URL for the agent, relative to the server ("*/meshrelay.ashx?...").
+type tunnelRequest struct {
+	Action     string `json:"action"` // "msg"
+	NodeID     string `json:"nodeid"`
+	Type       string `json:"type"` // "tunnel"
+	Usage      int    `json:"usage"`
+	Value      string `json:"value"`
+	ResponseID string `json:"responseid,omitempty"`
+}
+
+func (r *tunnelRequest) setResponseID(id string) { r.ResponseID = id }
+func (r *tunnelRequest) replyAction() string     { return "" }
+
+// Relay tunnels (meshrelay.ashx) carry binary data frames. Text frames are
+// either the single character "c", sent once the agent joined the session,
+// or JSON control messages on the tunnel control channel.
+
+// tunnelControlChannel identifies control messages inside a relay tunnel.
+const tunnelControlChannel = "102938"
+
+// tunnelControl is a control message inside a relay tunnel.
+type tunnelControl struct {
+	CtrlChannel channelID `json:"ctrlChannel"`
+	// Type is e.g. "rtt" (round trip time probe) or "close".
+	Type string `json:"type"`
+	Time int64  `json:"time,omitempty"`
+}
+
+// tunnelOptions sets up a terminal session once the agent joined.
+type tunnelOptions struct {
+	Protocol int    `json:"protocol"`
+	Cols     int    `json:"cols"`
+	Rows     int    `json:"rows"`
+	XTerm    bool   `json:"xterm"`
+	Type     string `json:"type"` // "options"
+}
+
+// channelID accepts both the string and the numeric form of a control
+// channel id, agents send either.
+type channelID string
+
+func (id *channelID) UnmarshalJSON(data []byte) error {
+	*id = channelID(bytes.Trim(data, `"`))
+	return nil
+}
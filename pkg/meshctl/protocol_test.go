@@ -0,0 +1,132 @@
+package meshctl
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Node IDs as the server hands them out, plus characters that would break
+// hand-assembled JSON
+var nodeIDs = []string{
+	"node//abc$def",
+	"node//a@b$c/d+e==",
+	`node//quote"d\back`,
+	"node//ünïcødé✓日本",
+	"node// line\ttab",
+}
+
+func TestTunnelRequestRoundTrip(t *testing.T) {
+	for _, id := range nodeIDs {
+		query := url.Values{}
+		query.Set("nodeid", id)
+		query.Set("rauth", `cookie"\`)
+		sent := &tunnelRequest{
+			Action: "msg",
+			NodeID: id,
+			Type:   "tunnel",
+			Usage:  1,
+			Value:  "*/meshrelay.ashx?" + query.Encode(),
+		}
+		sent.setResponseID("mcc1")
+
+		data, err := json.Marshal(sent)
+		if err != nil {
+			t.Fatalf("%q: %v", id, err)
+		}
+		var received tunnelRequest
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Fatalf("%q: %s: %v", id, data, err)
+		}
+		if received != *sent {
+			t.Errorf("%q: got %+v, want %+v", id, received, *sent)
+		}
+
+		// The agent finds the node again in the relay URL
+		u, err := url.Parse(strings.TrimPrefix(received.Value, "*"))
+		if err != nil {
+			t.Fatalf("%q: %v", id, err)
+		}
+		if got := u.Query().Get("nodeid"); got != id {
+			t.Errorf("relay URL nodeid = %q, want %q", got, id)
+		}
+	}
+}
+
+func TestUserAuthRequestRoundTrip(t *testing.T) {
+	for _, token := range []string{`12"34`, `\u0000`, "tökén", "</script>"} {
+		sent := userAuthRequest{Action: "userAuth", Auth: token + "cookie", Token: token}
+		data, err := json.Marshal(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received userAuthRequest
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if received != sent {
+			t.Errorf("got %+v, want %+v", received, sent)
+		}
+	}
+}
+
+func TestParseNodesRoundTrip(t *testing.T) {
+	nodes := make([]nodeInfo, len(nodeIDs))
+	for i, id := range nodeIDs {
+		nodes[i] = nodeInfo{ID: id, Name: id, RName: "host", Pwr: 1}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"action": "nodes",
+		"nodes":  map[string][]nodeInfo{"mesh//a$b": nodes},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := parseNodes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != len(nodeIDs) {
+		t.Fatalf("got %d devices, want %d", len(devices), len(nodeIDs))
+	}
+	for i, d := range devices {
+		if d.Id != nodeIDs[i] || d.DisplayName != nodeIDs[i] {
+			t.Errorf("device %d: got %q named %q, want %q", i, d.Id, d.DisplayName, nodeIDs[i])
+		}
+		if d.MeshID != "mesh//a$b" {
+			t.Errorf("device %d: mesh %q, want the key of its group", i, d.MeshID)
+		}
+	}
+}
+
+func TestChannelID(t *testing.T) {
+	tests := []struct {
+		message string
+		want    channelID
+	}{
+		{`{"ctrlChannel":"102938","type":"rtt"}`, tunnelControlChannel},
+		{`{"ctrlChannel":102938,"type":"rtt"}`, tunnelControlChannel},
+		{`{"ctrlChannel":"other","type":"close"}`, "other"},
+		{`{"type":"close"}`, ""},
+	}
+	for _, tt := range tests {
+		var control tunnelControl
+		if err := json.Unmarshal([]byte(tt.message), &control); err != nil {
+			t.Fatalf("%s: %v", tt.message, err)
+		}
+		if control.CtrlChannel != tt.want {
+			t.Errorf("%s: ctrlChannel = %q, want %q", tt.message, control.CtrlChannel, tt.want)
+		}
+	}
+
+	// Sent in the string form
+	data, err := json.Marshal(tunnelControl{CtrlChannel: tunnelControlChannel, Type: "close"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"ctrlChannel":"102938"`) {
+		t.Errorf("marshalled %s, want the string form", data)
+	}
+}
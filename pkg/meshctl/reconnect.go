@@ -0,0 +1,94 @@
+package meshctl
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// onConnectionLost is called by the reader of a control connection when it
+// exits. Connections closed by Close, or that never logged in, are not
+// reconnected.
+func (c *Client) onConnectionLost(conn *safeConn, loggedIn chan struct{}, cause error) {
+	select {
+	case <-loggedIn:
+	default:
+		return
+	}
+
+	c.connMu.Lock()
+	if c.webSocket != conn || !c.AutoReconnect {
+		c.connMu.Unlock()
+		return
+	}
+	c.webSocket = nil
+	if c.renewCookieTimer != nil {
+		c.renewCookieTimer.Stop()
+		c.renewCookieTimer = nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stopReconnect = cancel
+	c.connMu.Unlock()
+
+	conn.Close()
+	go c.reconnect(ctx, cause)
+}
+
+// reconnect re-establishes the control connection, backing off
+// exponentially between attempts, until it succeeds or Close is called.
+func (c *Client) reconnect(ctx context.Context, cause error) {
+	c.logf("Control connection lost, reconnecting: %v", cause)
+	if c.OnDisconnect != nil {
+		c.OnDisconnect(cause)
+	}
+
+	delay := minReconnectDelay
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		err := c.resume(ctx)
+		if ctx.Err() != nil {
+			// Close was called while we were connecting
+			c.closeConnection()
+			return
+		}
+		if err == nil {
+			break
+		}
+
+		c.logf("Reconnect attempt %d failed: %v", attempt, err)
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+
+	c.connMu.Lock()
+	c.stopReconnect = nil
+	c.connMu.Unlock()
+
+	c.logf("Control connection restored.")
+	if c.OnReconnect != nil {
+		c.OnReconnect()
+	}
+}
+
+// resume logs in again. The last auth cookie is tried first since it does
+// not need another 2FA token; once it expired, the credentials are used.
+func (c *Client) resume(ctx context.Context) error {
+	if aCookie, _ := c.cookies(); aCookie != "" {
+		err := c.connectOnce(ctx, aCookie)
+		if _, ok := err.(AuthError); !ok {
+			return err
+		}
+	}
+	return c.login(ctx)
+}
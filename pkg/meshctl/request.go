@@ -0,0 +1,81 @@
+package meshctl
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+)
+
+// pendingRequest is a request waiting for its reply.
+type pendingRequest struct {
+	// action matches replies without a responseid, if set, which go to
+	// the request with the lowest seq, i.e. sent first
+	action string
+	seq    uint64
+	reply  chan []byte
+}
+
+// request sends an action on the control connection tagged with a unique
+// responseid and waits for the reply carrying the same responseid, or for
+// a reply to its replyAction without any responseid. Any number of requests
+// may be in flight at once.
+func (c *Client) request(ctx context.Context, command requestMessage) ([]byte, error) {
+	seq := atomic.AddUint64(&c.lastRequestID, 1)
+	id := "mcc" + strconv.FormatUint(seq, 10)
+	reply := make(chan []byte, 1)
+
+	c.pendingMu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]*pendingRequest)
+	}
+	c.pending[id] = &pendingRequest{action: command.replyAction(), seq: seq, reply: reply}
+	closed := c.serverClosed
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	command.setResponseID(id)
+	if err := c.send(command); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-closed:
+		return nil, ErrConnectionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dispatchResponse hands a reply to the request waiting for it. A reply
+// without a responseid goes to the oldest request waiting for its action,
+// each request taking one. It returns false if nobody is waiting for the
+// reply.
+func (c *Client) dispatchResponse(id string, action string, message []byte) bool {
+	c.pendingMu.Lock()
+	if id == "" && action != "" {
+		var oldest uint64
+		for key, p := range c.pending {
+			if p.action == action && (id == "" || p.seq < oldest) {
+				id, oldest = key, p.seq
+			}
+		}
+	}
+	pending, ok := c.pending[id]
+	// Answered, a later reply goes to another request
+	delete(c.pending, id)
+	c.pendingMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	// Buffered for one reply and removed once answered, so never blocks
+	pending.reply <- message
+	return true
+}
@@ -0,0 +1,163 @@
+package meshctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Forward describes a local port forwarded to a TCP port reachable from a
+// node, or a UDP port if UDP is set. An empty Target means the node itself,
+// a zero LocalPort picks a random free port. If LocalPath is set, a unix
+// socket at that path is used instead of a local TCP port.
+//
+// BindAddress is the local address to listen on. It defaults to the
+// loopback interface, so that others on the network cannot use the
+// forward; "*" listens on all interfaces. Name optionally labels the
+// forward in Stats.
+type Forward struct {
+	Name        string
+	NodeID      string
+	BindAddress string
+	LocalPort   int
+	LocalPath   string
+	Target      string
+	RemotePort  int
+	UDP         bool
+}
+
+// Route listens on the local port or socket of f and relays every accepted
+// connection to the remote port through the node. If ready is non-nil, the
+// bound local port (zero for a socket) is sent on it once connections are
+// being accepted. Route runs until ctx is cancelled, which also closes all
+// open tunnels.
+func (c *Client) Route(ctx context.Context, f Forward, ready chan<- int) error {
+	if f.UDP {
+		return c.routeUDP(ctx, f, ready)
+	}
+
+	listener, err := listen(f)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		f.LocalPort = addr.Port
+	}
+
+	select {
+	case <-c.webChannel:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	state, untrack := c.trackForward(f, false, listener.Addr().String())
+	defer untrack()
+
+	if ready != nil {
+		ready <- f.LocalPort
+	}
+
+	return c.serve(ctx, listener, func(conn net.Conn) {
+		if err := c.forwardConn(ctx, conn, f, state); err != nil {
+			c.logf("%v", err)
+		}
+	})
+}
+
+// relayQuery returns the relay parameters for a TCP or UDP tunnel to f.
+func (c *Client) relayQuery(f Forward) url.Values {
+	port, addr := "tcpport", "tcpaddr"
+	if f.UDP {
+		port, addr = "udpport", "udpaddr"
+	}
+
+	aCookie, _ := c.cookies()
+	query := url.Values{}
+	query.Set("auth", aCookie)
+	query.Set("nodeid", f.NodeID)
+	query.Set(port, strconv.Itoa(f.RemotePort))
+	if f.Target != "" {
+		query.Set(addr, f.Target)
+	}
+	return query
+}
+
+// forwardConn relays an accepted connection to the remote port of f until
+// either side closes it, counting its traffic in state.
+func (c *Client) forwardConn(ctx context.Context, conn net.Conn, f Forward, state *forwardState) error {
+	c.debugf("Client connected")
+	defer conn.Close()
+	defer state.opened()()
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+	}
+
+	wsConn, err := c.dialRelay(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	c.pump(ctx, wsConn, conn, state)
+	return nil
+}
+
+// dialRelay opens a relay tunnel to the remote port of f.
+func (c *Client) dialRelay(ctx context.Context, f Forward) (*safeConn, error) {
+	relayURL, err := c.relayURL(c.relayQuery(f))
+	if err != nil {
+		return nil, err
+	}
+
+	c.debugf("Relay connecting to: %s", relayURL)
+
+	headers := http.Header{}
+	wsConn, _, err := c.dialer().DialContext(ctx, relayURL, headers)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnectFailed, err)
+	}
+	return newSafeConn(wsConn), nil
+}
+
+// Proxy relays the client's Stdin and Stdout to the remote port of f through
+// the node, for use as an SSH ProxyCommand. It returns once either side is
+// closed or ctx is cancelled, after everything received was written to
+// Stdout.
+func (c *Client) Proxy(ctx context.Context, f Forward) error {
+	if f.UDP {
+		return errors.New("UDP cannot be proxied over a byte stream")
+	}
+
+	listener := newStdioListener(c.stdio())
+	state, untrack := c.trackForward(f, false, listener.Addr().String())
+	defer untrack()
+
+	var proxyErr error
+	err := c.serve(ctx, listener, func(conn net.Conn) {
+		proxyErr = c.forwardConn(ctx, conn, f, state)
+	})
+	if proxyErr != nil {
+		return proxyErr
+	}
+	return err
+}
+
+// ProxyConn relays conn to the remote port of f through the node, like
+// Proxy does for Stdin and Stdout, and closes it when done.
+func (c *Client) ProxyConn(ctx context.Context, f Forward, conn net.Conn) error {
+	if f.UDP {
+		conn.Close()
+		return errors.New("UDP cannot be proxied over a byte stream")
+	}
+
+	state, untrack := c.trackForward(f, false, conn.LocalAddr().String())
+	defer untrack()
+	return c.forwardConn(ctx, conn, f, state)
+}
@@ -0,0 +1,306 @@
+package meshctl_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// route runs f on c until the test ends and returns its local port.
+func route(t *testing.T, c *meshctl.Client, f meshctl.Forward) int {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan int, 1)
+	routeErr := make(chan error, 1)
+	go func() {
+		routeErr <- c.Route(ctx, f, ready)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-routeErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("Route() = %v, want context.Canceled", err)
+		}
+	})
+
+	select {
+	case port := <-ready:
+		return port
+	case err := <-routeErr:
+		t.Fatal("Route:", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Route did not get ready")
+	}
+	return 0
+}
+
+func TestRouteTCP(t *testing.T) {
+	c := connect(t, newServer(t))
+	port := route(t, c, meshctl.Forward{NodeID: testNode, RemotePort: 22})
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for _, message := range []string{"hello", "world"} {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(message))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != message {
+			t.Errorf("echo = %q, want %q", buf, message)
+		}
+	}
+
+	stats := c.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Stats() returned %d forwards, want 1", len(stats))
+	}
+	if stats[0].Connections != 1 || stats[0].BytesOut != 10 {
+		t.Errorf("Stats() = %+v, want 1 connection and 10 bytes out", stats[0])
+	}
+	// The server is only pinged on request
+	if stats[0].ServerRTT != 0 {
+		t.Errorf("ServerRTT = %v before any ping, want 0", stats[0].ServerRTT)
+	}
+
+	rtt, err := c.PingServer(context.Background())
+	if err != nil {
+		t.Fatal("PingServer:", err)
+	}
+	if got := c.Stats()[0].ServerRTT; rtt <= 0 || got != rtt {
+		t.Errorf("ServerRTT = %v, want the %v measured by PingServer", got, rtt)
+	}
+}
+
+func TestRouteBeforeConnect(t *testing.T) {
+	c := newClient(t, newServer(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan int, 1)
+	routeErr := make(chan error, 1)
+	go func() {
+		routeErr <- c.Route(ctx, meshctl.Forward{NodeID: testNode, RemotePort: 22}, ready)
+	}()
+	defer func() {
+		cancel()
+		if err := <-routeErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("Route() = %v, want context.Canceled", err)
+		}
+	}()
+
+	select {
+	case <-ready:
+		t.Fatal("Route got ready before Connect")
+	case err := <-routeErr:
+		t.Fatal("Route:", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal("Connect:", err)
+	}
+	var port int
+	select {
+	case port = <-ready:
+	case err := <-routeErr:
+		t.Fatal("Route:", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Route did not get ready after Connect")
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("read %q, %v, want the echo of hello", buf, err)
+	}
+}
+
+func TestRouteUnixSocket(t *testing.T) {
+	c := connect(t, newServer(t))
+	path := filepath.Join(t.TempDir(), "ssh.sock")
+	route(t, c, meshctl.Forward{NodeID: testNode, LocalPath: path, RemotePort: 22})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %v, want 0600", perm)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("echo = %q, want hello", buf)
+	}
+}
+
+func TestRouteReplacesStaleSocket(t *testing.T) {
+	c := connect(t, newServer(t))
+	path := filepath.Join(t.TempDir(), "ssh.sock")
+
+	// A crashed process leaves its socket behind
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatal("no stale socket:", err)
+	}
+
+	route(t, c, meshctl.Forward{NodeID: testNode, LocalPath: path, RemotePort: 22})
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal("Dial after replacing the stale socket:", err)
+	}
+	conn.Close()
+}
+
+func TestRouteKeepsLiveSocket(t *testing.T) {
+	c := connect(t, newServer(t))
+	dir := t.TempDir()
+
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{live, file} {
+		err := c.Route(context.Background(), meshctl.Forward{NodeID: testNode, LocalPath: path, RemotePort: 22}, nil)
+		if !errors.Is(err, meshctl.ErrBindFailed) {
+			t.Errorf("Route(%s) = %v, want ErrBindFailed", path, err)
+		}
+	}
+
+	// Neither was removed
+	conn, err := net.Dial("unix", live)
+	if err != nil {
+		t.Error("live socket removed:", err)
+	} else {
+		conn.Close()
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("file = %q, %v, want it untouched", data, err)
+	}
+}
+
+func TestRouteLogsFailedConnections(t *testing.T) {
+	srv := newServer(t)
+	srv.DialTCP = func(nodeID string, target string, port int) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	c := connect(t, srv)
+	var log, stdout syncBuffer
+	c.Log = &log
+	c.Stdout = &stdout
+	port := route(t, c, meshctl.Forward{NodeID: testNode, RemotePort: 22})
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The failed tunnel closes the connection and is reported to Log only
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() succeeded, want the connection closed")
+	}
+	waitForOutput(t, &log, "bad handshake")
+	if stdout.String() != "" {
+		t.Errorf("stdout = %q, want nothing", stdout.String())
+	}
+}
+
+func TestRouteUDP(t *testing.T) {
+	c := connect(t, newServer(t))
+	port := route(t, c, meshctl.Forward{NodeID: testNode, RemotePort: 161, UDP: true})
+
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for _, datagram := range []string{"first", "second"} {
+		if _, err := conn.Write([]byte(datagram)); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != datagram {
+			t.Errorf("echo = %q, want %q", buf[:n], datagram)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	c := connect(t, newServer(t))
+	stdin, input := io.Pipe()
+	var stdout syncBuffer
+	c.Stdin = stdin
+	c.Stdout = &stdout
+
+	proxyErr := make(chan error, 1)
+	go func() {
+		proxyErr <- c.Proxy(context.Background(), meshctl.Forward{NodeID: testNode, RemotePort: 22})
+	}()
+
+	input.Write([]byte("SSH-2.0-test\r\n"))
+	waitForOutput(t, &stdout, "SSH-2.0-test\r\n")
+
+	// The end of the input ends the proxy
+	input.Close()
+	select {
+	case err := <-proxyErr:
+		if err != nil {
+			t.Errorf("Proxy() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Proxy did not return after its input ended")
+	}
+}
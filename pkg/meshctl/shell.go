@@ -0,0 +1,261 @@
+package meshctl
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+const exitKey = 0x1D // Ctrl-]
+
+func randomHex() (string, error) {
+	bytes := make([]byte, 5)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Terminal is what a shell session is attached to.
+type Terminal struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Cols and Rows are the size of the terminal. If zero, they are taken
+	// from Stdout when it is a terminal.
+	Cols int
+	Rows int
+}
+
+// Shell opens an interactive terminal session on the node, attached to the
+// client's Stdin and Stdout. Protocol 1 is the default shell, 6 is
+// PowerShell on Windows agents. Cancelling ctx closes the session.
+func (c *Client) Shell(ctx context.Context, nodeID string, protocol int) error {
+	stdin, stdout := c.stdio()
+	return c.ShellOn(ctx, nodeID, protocol, Terminal{Stdin: stdin, Stdout: stdout})
+}
+
+// ShellOn is like Shell, but attaches the session to t.
+func (c *Client) ShellOn(ctx context.Context, nodeID string, protocol int, t Terminal) error {
+	select {
+	case <-c.webChannel:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	id, err := randomHex()
+	if err != nil {
+		return err
+	}
+	aCookie, rCookie := c.cookies()
+
+	// Ask the agent to join the relay session...
+	agentQuery := url.Values{}
+	agentQuery.Set("p", "1")
+	agentQuery.Set("nodeid", nodeID)
+	agentQuery.Set("id", id)
+	agentQuery.Set("rauth", rCookie)
+	err = c.send(tunnelRequest{
+		Action:     "msg",
+		NodeID:     nodeID,
+		Type:       "tunnel",
+		Usage:      1,
+		Value:      "*/meshrelay.ashx?" + agentQuery.Encode(),
+		ResponseID: "meshctrl",
+	})
+	if err != nil {
+		return err
+	}
+
+	// ...and join it ourselves
+	query := url.Values{}
+	query.Set("browser", "1")
+	query.Set("p", "1")
+	query.Set("nodeid", nodeID)
+	query.Set("id", id)
+	query.Set("auth", aCookie)
+	wsUrl, err := c.relayURL(query)
+	if err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	wsConn, _, err := c.dialer().DialContext(ctx, wsUrl, headers)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnectFailed, err)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		wsConn.Close()
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	go c.onShellWebSocket(newSafeConn(wsConn), protocol, t, done)
+	<-done
+
+	c.debugf("Websocket closed")
+	return ctx.Err()
+}
+
+func (c *Client) onShellWebSocket(wsConn *safeConn, protocol int, t Terminal, done chan struct{}) {
+	c.debugf("Websocket connected")
+	defer wsConn.Close()
+
+	stdin, stdout := t.Stdin, t.Stdout
+
+	// Only a terminal needs raw mode, tests and pipes are used as they are
+	restore := func() {}
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		oldState, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			c.logf("Failed to set raw mode: %v", err)
+			close(done)
+			return
+		}
+		restore = func() {
+			term.Restore(int(f.Fd()), oldState)
+		}
+	}
+	defer restore()
+
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	closeQuit := func() {
+		quitOnce.Do(func() {
+			close(quit)
+		})
+	}
+	var wg sync.WaitGroup
+
+	// Send RTT every 5 seconds
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				err := wsConn.WriteJSON(tunnelControl{
+					CtrlChannel: tunnelControlChannel,
+					Type:        "rtt",
+					Time:        time.Now().UnixMilli(),
+				})
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// Read from WebSocket
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			msgType, msg, err := wsConn.ReadMessage()
+			if err != nil {
+				if c.Debug && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					c.logf("Error reading message: %v", err)
+				}
+				restore()
+				closeQuit()
+				close(done)
+				return
+			}
+
+			if msgType != websocket.BinaryMessage {
+				if string(msg) == "c" {
+					c.debugf("Received 'c' message")
+					sendOptionsUpdate(wsConn, protocol, t)
+					if err := wsConn.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(protocol))); err != nil {
+						// Closing the connection lets the read above clean up
+						wsConn.Close()
+					}
+					continue
+				}
+
+				var control tunnelControl
+				if err := json.Unmarshal(msg, &control); err != nil {
+					c.debugf("Error parsing control message: %v", err)
+					continue
+				}
+				if control.CtrlChannel == tunnelControlChannel && control.Type == "close" {
+					// The agent ended the session, the next read fails
+					wsConn.Close()
+				}
+			} else {
+				stdout.Write(msg)
+			}
+		}
+	}()
+
+	// Read from stdin
+	reader := bufio.NewReader(stdin)
+	for {
+		select {
+		case <-quit:
+			wg.Wait()
+			return
+		default:
+		}
+
+		r, size, err := reader.ReadRune()
+		if err != nil {
+			closeQuit()
+			break
+		}
+
+		if r == rune(exitKey) && size == 1 {
+			c.logf("\n[exit] Detected Ctrl-]")
+			wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, `{"ctrlChannel":"102938","type":"close"}`))
+			closeQuit()
+			break
+		}
+
+		buf := make([]byte, utf8.RuneLen(r))
+		utf8.EncodeRune(buf, r)
+
+		err = wsConn.WriteMessage(websocket.BinaryMessage, buf)
+		if err != nil {
+			closeQuit()
+			break
+		}
+	}
+
+	wg.Wait()
+}
+
+func sendOptionsUpdate(wsConn *safeConn, protocol int, t Terminal) {
+	cols, rows := t.Cols, t.Rows
+	if f, ok := t.Stdout.(*os.File); ok && cols == 0 && rows == 0 {
+		cols, rows, _ = term.GetSize(int(f.Fd()))
+	}
+
+	wsConn.WriteJSON(tunnelOptions{
+		Protocol: protocol,
+		Cols:     cols,
+		Rows:     rows,
+		XTerm:    true,
+		Type:     "options",
+	})
+}
@@ -0,0 +1,36 @@
+package meshctl_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+func TestShellOn(t *testing.T) {
+	c := connect(t, newServer(t))
+	stdin, input := io.Pipe()
+	defer input.Close()
+	var stdout syncBuffer
+
+	shellErr := make(chan error, 1)
+	go func() {
+		shellErr <- c.ShellOn(context.Background(), testNode, 1, meshctl.Terminal{Stdin: stdin, Stdout: &stdout, Cols: 80, Rows: 24})
+	}()
+
+	input.Write([]byte("ls -l\n"))
+	waitForOutput(t, &stdout, "ls -l\n")
+
+	// Ctrl-] ends the session
+	input.Write([]byte{0x1d})
+	select {
+	case err := <-shellErr:
+		if err != nil {
+			t.Errorf("ShellOn() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ShellOn did not return after Ctrl-]")
+	}
+}
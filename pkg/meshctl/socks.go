@@ -0,0 +1,283 @@
+package meshctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 protocol constants, see RFC 1928
+const (
+	socksVersion      = 0x05
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xFF
+	socksCmdConnect   = 0x01
+	socksAddrIPv4     = 0x01
+	socksAddrDomain   = 0x03
+	socksAddrIPv6     = 0x04
+	socksSucceeded    = 0x00
+	socksGeneralFail  = 0x01
+	socksCmdNotSupp   = 0x07
+	socksAddrNotSupp  = 0x08
+)
+
+// socksHandshakeTimeout bounds the proxy handshake of a client
+const socksHandshakeTimeout = 30 * time.Second
+
+// DynamicForward describes a local SOCKS5 proxy whose connections are
+// relayed through a node to whatever address each client asks for. With
+// HTTP set, the same port also accepts HTTP CONNECT requests. BindAddress
+// works as for Forward.
+type DynamicForward struct {
+	NodeID      string
+	BindAddress string
+	LocalPort   int
+	HTTP        bool
+}
+
+// Socks runs a SOCKS5 proxy on the local port of f and opens a relay tunnel
+// through the node for every requested address, like ssh -D. If ready is
+// non-nil, the bound local port is sent on it once connections are being
+// accepted. Socks runs until ctx is cancelled.
+func (c *Client) Socks(ctx context.Context, f DynamicForward, ready chan<- int) error {
+	address := localAddress(f.BindAddress, f.LocalPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("%w: TCP %s: %v", ErrBindFailed, address, err)
+	}
+	f.LocalPort = listener.Addr().(*net.TCPAddr).Port
+	defer listener.Close()
+
+	select {
+	case <-c.webChannel:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	state, untrack := c.trackForward(Forward{
+		NodeID:      f.NodeID,
+		BindAddress: f.BindAddress,
+		LocalPort:   f.LocalPort,
+	}, true, listener.Addr().String())
+	defer untrack()
+
+	if ready != nil {
+		ready <- f.LocalPort
+	}
+
+	return c.serve(ctx, listener, func(conn net.Conn) {
+		c.onSocksClientConnected(ctx, conn, f, state)
+	})
+}
+
+// bufferedConn is a net.Conn whose reads go through the reader that was
+// used to parse the proxy handshake, so no buffered data is lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (c *Client) onSocksClientConnected(ctx context.Context, conn net.Conn, f DynamicForward, state *forwardState) {
+	defer conn.Close()
+	defer state.opened()()
+
+	// Don't let a silent client hold the connection open forever
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	r := bufio.NewReader(conn)
+
+	first, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+
+	var host string
+	var port int
+	var reply func(ok bool) error
+	if first[0] == socksVersion {
+		host, port, err = socksHandshake(r, conn)
+		reply = func(ok bool) error {
+			return socksReply(conn, ok)
+		}
+	} else if f.HTTP {
+		host, port, err = httpConnectHandshake(r, conn)
+		reply = func(ok bool) error {
+			return httpConnectReply(conn, ok)
+		}
+	} else {
+		err = errors.New("not a SOCKS5 request")
+	}
+	if err != nil {
+		c.debugf("Proxy handshake failed: %v", err)
+		return
+	}
+
+	c.debugf("Proxy request for %s", net.JoinHostPort(host, strconv.Itoa(port)))
+
+	wsConn, err := c.dialRelay(ctx, Forward{
+		NodeID:     f.NodeID,
+		Target:     relayTarget(host),
+		RemotePort: port,
+	})
+	if err != nil {
+		c.logf("%v", err)
+		reply(false)
+		return
+	}
+
+	if err := reply(true); err != nil {
+		wsConn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.pump(ctx, wsConn, &bufferedConn{Conn: conn, r: r}, state)
+}
+
+// relayTarget returns the tcpaddr for host. Loopback addresses mean the
+// node itself, which the relay expects as an empty address.
+func relayTarget(host string) string {
+	if host == "localhost" {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return ""
+	}
+	return host
+}
+
+// socksHandshake negotiates the authentication method and reads the
+// CONNECT request, returning the requested host and port. Failures are
+// answered on w before returning.
+func socksHandshake(r *bufio.Reader, w io.Writer) (string, int, error) {
+	// Greeting: version, method count, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", 0, err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", 0, err
+	}
+
+	acceptable := false
+	for _, m := range methods {
+		if m == socksNoAuth {
+			acceptable = true
+		}
+	}
+	if !acceptable {
+		w.Write([]byte{socksVersion, socksNoAcceptable})
+		return "", 0, errors.New("no supported SOCKS5 authentication method")
+	}
+	if _, err := w.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", 0, err
+	}
+
+	// Request: version, command, reserved, address type, address, port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil {
+		return "", 0, err
+	}
+	if request[0] != socksVersion {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		size, err := r.ReadByte()
+		if err != nil {
+			return "", 0, err
+		}
+		domain := make([]byte, size)
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", 0, err
+		}
+		host = string(domain)
+	default:
+		socksReplyCode(w, socksAddrNotSupp)
+		return "", 0, fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, portBytes); err != nil {
+		return "", 0, err
+	}
+
+	// Only CONNECT can be relayed, the relay has no BIND or UDP ASSOCIATE
+	if request[1] != socksCmdConnect {
+		socksReplyCode(w, socksCmdNotSupp)
+		return "", 0, fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	return host, int(binary.BigEndian.Uint16(portBytes)), nil
+}
+
+func socksReply(w io.Writer, ok bool) error {
+	if ok {
+		return socksReplyCode(w, socksSucceeded)
+	}
+	return socksReplyCode(w, socksGeneralFail)
+}
+
+// socksReplyCode answers a request. The bound address is not known on our
+// side of the relay, so it is always reported as 0.0.0.0:0.
+func socksReplyCode(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socksVersion, code, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// httpConnectHandshake reads an HTTP CONNECT request and returns the
+// requested host and port. Other methods are answered with an error.
+func httpConnectHandshake(r *bufio.Reader, w io.Writer) (string, int, error) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", 0, err
+	}
+	if req.Method != http.MethodConnect {
+		fmt.Fprint(w, "HTTP/1.1 405 Method Not Allowed\r\nAllow: CONNECT\r\nConnection: close\r\n\r\n")
+		return "", 0, fmt.Errorf("unsupported HTTP method %s", req.Method)
+	}
+
+	host, portString, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		fmt.Fprint(w, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil || port <= 0 || port > 65535 {
+		fmt.Fprint(w, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return "", 0, fmt.Errorf("invalid port %q", portString)
+	}
+	return host, port, nil
+}
+
+func httpConnectReply(w io.Writer, ok bool) error {
+	if ok {
+		_, err := fmt.Fprint(w, "HTTP/1.1 200 Connection established\r\n\r\n")
+		return err
+	}
+	_, err := fmt.Fprint(w, "HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n")
+	return err
+}
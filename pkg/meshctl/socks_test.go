@@ -0,0 +1,161 @@
+package meshctl_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshcentraltest"
+	"github.com/lexpaval/mesh-central-client-go/pkg/meshctl"
+)
+
+// socks runs a proxy for f on c until the test ends and returns a
+// connection to it.
+func socks(t *testing.T, c *meshctl.Client, f meshctl.DynamicForward) net.Conn {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan int, 1)
+	socksErr := make(chan error, 1)
+	go func() {
+		socksErr <- c.Socks(ctx, f, ready)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-socksErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("Socks() = %v, want context.Canceled", err)
+		}
+	})
+
+	var port int
+	select {
+	case port = <-ready:
+	case err := <-socksErr:
+		t.Fatal("Socks:", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Socks did not get ready")
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// checkTunnel checks that conn is relayed to an echo service and that the
+// last relay requested from srv is want.
+func checkTunnel(t *testing.T, srv *meshcentraltest.Server, conn io.ReadWriter, want meshcentraltest.Relay) {
+	t.Helper()
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("echo = %q, want hello", buf)
+	}
+
+	relays := srv.Relays()
+	if len(relays) == 0 || relays[len(relays)-1] != want {
+		t.Errorf("Relays() = %+v, want %+v last", relays, want)
+	}
+}
+
+func TestSocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		port   uint16
+		target string
+	}{
+		{name: "domain", host: "db.internal", port: 5432, target: "db.internal"},
+		{name: "IPv4", host: "10.0.0.7", port: 80, target: "10.0.0.7"},
+		{name: "IPv6", host: "fd00::7", port: 80, target: "fd00::7"},
+		// Loopback is the node itself
+		{name: "localhost", host: "localhost", port: 22, target: ""},
+		{name: "IPv4 loopback", host: "127.0.0.1", port: 22, target: ""},
+		{name: "IPv6 loopback", host: "::1", port: 22, target: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t)
+			conn := socks(t, connect(t, srv), meshctl.DynamicForward{NodeID: testNode})
+
+			// Greeting without authentication
+			conn.Write([]byte{5, 1, 0})
+			reply := make([]byte, 2)
+			if _, err := io.ReadFull(conn, reply); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reply, []byte{5, 0}) {
+				t.Fatalf("greeting reply = %v, want [5 0]", reply)
+			}
+
+			// CONNECT with the address type of host
+			request := []byte{5, 1, 0}
+			if addr, err := netip.ParseAddr(tt.host); err != nil {
+				request = append(append(request, 3, byte(len(tt.host))), tt.host...)
+			} else if addr.Is4() {
+				request = append(append(request, 1), addr.AsSlice()...)
+			} else {
+				request = append(append(request, 4), addr.AsSlice()...)
+			}
+			request = binary.BigEndian.AppendUint16(request, tt.port)
+			conn.Write(request)
+			reply = make([]byte, 10)
+			if _, err := io.ReadFull(conn, reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply[0] != 5 || reply[1] != 0 {
+				t.Fatalf("connect reply = %v, want success", reply)
+			}
+
+			checkTunnel(t, srv, conn, meshcentraltest.Relay{NodeID: testNode, Target: tt.target, Port: int(tt.port)})
+		})
+	}
+}
+
+func TestSocksHTTPConnect(t *testing.T) {
+	srv := newServer(t)
+	conn := socks(t, connect(t, srv), meshctl.DynamicForward{NodeID: testNode, HTTP: true})
+
+	conn.Write([]byte("CONNECT db.internal:5432 HTTP/1.1\r\nHost: db.internal:5432\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT status = %s, want 200", response.Status)
+	}
+
+	checkTunnel(t, srv, struct {
+		io.Reader
+		io.Writer
+	}{r, conn}, meshcentraltest.Relay{NodeID: testNode, Target: "db.internal", Port: 5432})
+}
+
+func TestSocksHTTPConnectDisabled(t *testing.T) {
+	srv := newServer(t)
+	conn := socks(t, connect(t, srv), meshctl.DynamicForward{NodeID: testNode})
+
+	// Without HTTP, anything but SOCKS5 is dropped
+	conn.Write([]byte("CONNECT db.internal:5432 HTTP/1.1\r\n\r\n"))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Read() = %d bytes, want the connection closed", n)
+	}
+	if relays := srv.Relays(); len(relays) != 0 {
+		t.Errorf("Relays() = %+v, want none", relays)
+	}
+}
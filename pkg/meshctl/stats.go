@@ -0,0 +1,142 @@
+package meshctl
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// rttInterval is how often MeasureServerRTT pings the server
+const rttInterval = 5 * time.Second
+
+// ForwardStats is a snapshot of the traffic of a running forward.
+type ForwardStats struct {
+	Forward Forward
+
+	// Socks is set for a SOCKS proxy, whose Forward has no remote port.
+	Socks bool
+
+	// LocalAddr is the address the forward listens on.
+	LocalAddr string
+
+	Started time.Time
+
+	// Connections counts the accepted connections (UDP sessions for UDP),
+	// Active those still open.
+	Connections int64
+	Active      int64
+
+	// BytesIn were received from the node, BytesOut sent to it.
+	BytesIn  int64
+	BytesOut int64
+
+	// ServerRTT is the latest round trip time to the server measured by
+	// PingServer or MeasureServerRTT, the same for all forwards and zero
+	// until one was measured. The round trip to the agent is not known,
+	// agents do not answer probes inside a tunnel.
+	ServerRTT time.Duration
+}
+
+// forwardState holds the live counters of a running forward.
+type forwardState struct {
+	forward   Forward
+	socks     bool
+	localAddr string
+	started   time.Time
+
+	connections atomic.Int64
+	active      atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+}
+
+// trackForward registers a running forward, its stats are reported by
+// Stats until the returned function is called.
+func (c *Client) trackForward(f Forward, socks bool, localAddr string) (*forwardState, func()) {
+	state := &forwardState{
+		forward:   f,
+		socks:     socks,
+		localAddr: localAddr,
+		started:   time.Now(),
+	}
+
+	c.statsMu.Lock()
+	c.forwards = append(c.forwards, state)
+	c.statsMu.Unlock()
+
+	return state, func() {
+		c.statsMu.Lock()
+		defer c.statsMu.Unlock()
+		c.forwards = slices.DeleteFunc(c.forwards, func(s *forwardState) bool {
+			return s == state
+		})
+	}
+}
+
+// PingServer measures the round trip time to the server over the control
+// connection. It is reported as ServerRTT by Stats.
+func (c *Client) PingServer(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	sent := time.Now()
+	if _, err := c.request(ctx, &pingRequest{Action: "ping"}); err != nil {
+		return 0, err
+	}
+	rtt := time.Since(sent)
+	c.rtt.Store(int64(rtt))
+	return rtt, nil
+}
+
+// MeasureServerRTT calls PingServer every few seconds until ctx is
+// cancelled. Failed pings are ignored, the forwards notice a lost
+// connection anyway.
+func (c *Client) MeasureServerRTT(ctx context.Context) {
+	ticker := time.NewTicker(rttInterval)
+	defer ticker.Stop()
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, rttInterval)
+		c.PingServer(pingCtx)
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats returns the traffic of the forwards currently running on the
+// client, in the order they were started.
+func (c *Client) Stats() []ForwardStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	rtt := time.Duration(c.rtt.Load())
+	stats := make([]ForwardStats, len(c.forwards))
+	for i, s := range c.forwards {
+		stats[i] = ForwardStats{
+			Forward:     s.forward,
+			Socks:       s.socks,
+			LocalAddr:   s.localAddr,
+			Started:     s.started,
+			Connections: s.connections.Load(),
+			Active:      s.active.Load(),
+			BytesIn:     s.bytesIn.Load(),
+			BytesOut:    s.bytesOut.Load(),
+			ServerRTT:   rtt,
+		}
+	}
+	return stats
+}
+
+// opened counts a new connection, the returned function marks it closed.
+func (s *forwardState) opened() func() {
+	s.connections.Add(1)
+	s.active.Add(1)
+	return func() {
+		s.active.Add(-1)
+	}
+}
@@ -0,0 +1,180 @@
+package meshctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultUDPIdleTimeout is how long a UDP session is kept without traffic
+// when Client.UDPIdleTimeout is not set.
+const DefaultUDPIdleTimeout = 2 * time.Minute
+
+// udpQueueSize is the number of datagrams buffered per session while its
+// tunnel is being opened. Later datagrams are dropped, as UDP allows.
+const udpQueueSize = 64
+
+// udpSession relays the datagrams of one local source address through its
+// own relay tunnel. The relay carries one datagram per websocket message.
+type udpSession struct {
+	packets chan []byte
+}
+
+// routeUDP listens on the local UDP port of f and relays datagrams to the
+// remote port through the node, with one tunnel per source address. It
+// follows the contract of Route.
+func (c *Client) routeUDP(ctx context.Context, f Forward, ready chan<- int) error {
+	if f.LocalPath != "" {
+		return fmt.Errorf("%w: UDP cannot be forwarded from socket %s", ErrBindFailed, f.LocalPath)
+	}
+
+	address := localAddress(f.BindAddress, f.LocalPort)
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return fmt.Errorf("%w: UDP %s: %v", ErrBindFailed, address, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("%w: UDP %s: %v", ErrBindFailed, address, err)
+	}
+	f.LocalPort = conn.LocalAddr().(*net.UDPAddr).Port
+	defer conn.Close()
+
+	select {
+	case <-c.webChannel:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	state, untrack := c.trackForward(f, false, conn.LocalAddr().String())
+	defer untrack()
+
+	if ready != nil {
+		ready <- f.LocalPort
+	}
+
+	// Unblock ReadFromUDP once we are cancelled
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	var mu sync.Mutex
+	sessions := make(map[string]*udpSession)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	buf := make([]byte, 65535)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.logf("Error reading datagram: %v", err)
+			continue
+		}
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+
+		key := src.String()
+		mu.Lock()
+		session, ok := sessions[key]
+		if !ok {
+			c.debugf("UDP session started for %v", key)
+			session = &udpSession{packets: make(chan []byte, udpQueueSize)}
+			sessions[key] = session
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.runUDPSession(ctx, conn, src, f, session, state)
+
+				mu.Lock()
+				delete(sessions, key)
+				mu.Unlock()
+				c.debugf("UDP session ended for %v", key)
+			}()
+		}
+		// Sent under the lock, so a session is never fed after it is removed
+		select {
+		case session.packets <- packet:
+		default:
+		}
+		mu.Unlock()
+	}
+}
+
+// runUDPSession opens the tunnel of a session and relays datagrams both
+// ways until it is idle for the client's UDPIdleTimeout, the tunnel closes
+// or ctx is cancelled.
+func (c *Client) runUDPSession(ctx context.Context, conn *net.UDPConn, src *net.UDPAddr, f Forward, session *udpSession, state *forwardState) {
+	defer state.opened()()
+
+	wsConn, err := c.dialRelay(ctx, f)
+	if err != nil {
+		c.logf("%v", err)
+		return
+	}
+	defer wsConn.Close()
+
+	idleTimeout := c.UDPIdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultUDPIdleTimeout
+	}
+
+	// Replies go straight back to the source address
+	replies := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			messageType, message, err := wsConn.ReadMessage()
+			if err != nil {
+				// Closing an idle session also ends up here
+				if c.Debug && !errors.Is(err, net.ErrClosed) && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					c.logf("WebSocket read error: %v", err)
+				}
+				return
+			}
+			if messageType != websocket.BinaryMessage {
+				continue
+			}
+			if _, err := conn.WriteToUDP(message, src); err != nil {
+				return
+			}
+			state.bytesIn.Add(int64(len(message)))
+			select {
+			case replies <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case packet := <-session.packets:
+			if err := wsConn.WriteMessage(websocket.BinaryMessage, packet); err != nil {
+				return
+			}
+			state.bytesOut.Add(int64(len(packet)))
+		case <-replies:
+		case <-idle.C:
+			return
+		case <-closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+		idle.Reset(idleTimeout)
+	}
+}